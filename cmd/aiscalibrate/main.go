@@ -0,0 +1,107 @@
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "flag"
+    "fmt"
+    "net/http"
+    "os"
+    "sort"
+    "strings"
+
+    "ais-demo/internal/ais"
+)
+
+func main() {
+    data := flag.String("data", "", "labelled cases, one JSON {id, uia, apa, aligned} per line")
+    out := flag.String("out", "calibration.json", "calibration file to write (empty to skip)")
+    methods := flag.String("methods", "", "csv of APr methods to evaluate (default: all registered)")
+    minPrecision := flag.Float64("min-precision", 0, "pick the highest-recall threshold with at least this precision (0: best F1)")
+    showROC := flag.Bool("roc", false, "print every ROC point")
+    ollama := flag.String("ollama", "", "Ollama URL; registers embedding-cosine-v1 and llm-judge-v1")
+    embedModel := flag.String("embed-model", "nomic-embed-text", "embedding model for embedding-cosine-v1")
+    judgeModel := flag.String("judge-model", "llama3", "judge model for llm-judge-v1")
+    policies := flag.String("policies", "", "policy directory for external-policy-v1 (default: built-in policy)")
+    flag.Parse()
+    if *data == "" { flag.Usage(); os.Exit(2) }
+
+    if *ollama != "" {
+        ais.RegisterVerifier(ais.EmbeddingVerifier{Client: &ais.OllamaClient{BaseURL: *ollama, Model: *embedModel, HTTP: http.DefaultClient}})
+        ais.RegisterVerifier(ais.JudgeVerifier{Client: &ais.OllamaClient{BaseURL: *ollama, Model: *judgeModel, HTTP: http.DefaultClient}})
+    }
+    if *policies != "" {
+        eng, err := ais.LoadPolicies(*policies)
+        if err != nil { fatal(err) }
+        ais.RegisterVerifier(ais.ExternalPolicyVerifier{Engine: eng})
+    }
+    raw, err := os.ReadFile(*data)
+    if err != nil { fatal(err) }
+    cases, err := readCases(raw)
+    if err != nil { fatal(fmt.Errorf("%s: %w", *data, err)) }
+    ms := ais.RegisteredMethods()
+    if *methods != "" { ms = strings.Split(*methods, ",") }
+
+    // group cases by policy profile
+    byProfile := map[string][]ais.CalibrationCase{}
+    for _, c := range cases { byProfile[profileOf(c)] = append(byProfile[profileOf(c)], c) }
+    profiles := make([]string, 0, len(byProfile))
+    for p := range byProfile { profiles = append(profiles, p) }
+    sort.Strings(profiles)
+
+    sum := sha256.Sum256(raw)
+    cal := ais.Calibration{Dataset: "sha256:" + hex.EncodeToString(sum[:]), Profiles: map[string]map[string]ais.CalibratedThreshold{}}
+    fmt.Printf("%-18s %-24s %5s %6s %9s %9s %7s %6s\n", "profile", "method", "cases", "auc", "threshold", "precision", "recall", "f1")
+    for _, p := range profiles {
+        pc := byProfile[p]
+        for _, m := range ms {
+            v, ok := ais.LookupVerifier(m)
+            if !ok { fatal(fmt.Errorf("unknown method %q", m)) }
+            scores, labels := make([]float64, len(pc)), make([]bool, len(pc))
+            for i, c := range pc { scores[i], labels[i] = v.Verify(c.UIA, c.APA).Coverage, c.Aligned }
+            pts, auc := ais.ROC(scores, labels)
+            best := ais.BestThreshold(pts, *minPrecision)
+            if cal.Profiles[p] == nil { cal.Profiles[p] = map[string]ais.CalibratedThreshold{} }
+            cal.Profiles[p][m] = ais.CalibratedThreshold{Threshold: best.Threshold, Precision: best.Precision, Recall: best.Recall, F1: best.F1, AUC: auc, Cases: len(pc)}
+            fmt.Printf("%-18s %-24s %5d %6.3f %9.3f %9.3f %7.3f %6.3f\n", p, m, len(pc), auc, best.Threshold, best.Precision, best.Recall, best.F1)
+            if f := ais.ProfileFloor(p); best.Threshold < f { fmt.Printf("    threshold below the profile floor %.3f; the guard uses the floor\n", f) }
+            if *showROC {
+                for _, pt := range pts {
+                    fmt.Printf("    t>=%.3f tp=%d fp=%d tn=%d fn=%d precision=%.3f recall=%.3f fpr=%.3f\n", pt.Threshold, pt.TP, pt.FP, pt.TN, pt.FN, pt.Precision, pt.Recall, pt.FPR)
+                }
+            }
+        }
+    }
+    if *out == "" { return }
+    b, _ := json.MarshalIndent(cal, "", "  ")
+    if err := os.WriteFile(*out, append(b, '\n'), 0644); err != nil { fatal(err) }
+    fmt.Printf("\nwrote %s\n", *out)
+}
+
+func readCases(raw []byte) ([]ais.CalibrationCase, error) {
+    var cases []ais.CalibrationCase
+    sc := bufio.NewScanner(bytes.NewReader(raw))
+    sc.Buffer(make([]byte, 0, 64*1024), 16<<20)
+    for n := 1; sc.Scan(); n++ {
+        line := bytes.TrimSpace(sc.Bytes())
+        if len(line) == 0 { continue }
+        var c ais.CalibrationCase
+        if err := json.Unmarshal(line, &c); err != nil { return nil, fmt.Errorf("line %d: %w", n, err) }
+        cases = append(cases, c)
+    }
+    if len(cases) == 0 { return nil, fmt.Errorf("no cases") }
+    return cases, sc.Err()
+}
+
+func profileOf(c ais.CalibrationCase) string {
+    if c.UIA.PolicyProfile == "" { return "default" }
+    return c.UIA.PolicyProfile
+}
+
+func fatal(err error) {
+    fmt.Fprintln(os.Stderr, "aiscalibrate:", err)
+    os.Exit(1)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+    "encoding/json"
+    "flag"
+    "fmt"
+    "os"
+    "path/filepath"
+
+    "ais-demo/internal/ais"
+)
+
+const usage = `usage:
+  aisctl policy test [-dir policies] [fixture.json ...]
+  aisctl policy eval [-dir policies] [-profile p] -uia uia.json -apa apa.json`
+
+func main() {
+    if len(os.Args) < 3 || os.Args[1] != "policy" { fmt.Fprintln(os.Stderr, usage); os.Exit(2) }
+    switch os.Args[2] {
+    case "test":
+        os.Exit(policyTest(os.Args[3:]))
+    case "eval":
+        os.Exit(policyEval(os.Args[3:]))
+    }
+    fmt.Fprintln(os.Stderr, usage)
+    os.Exit(2)
+}
+
+// policyTest runs policy fixtures (default <dir>/tests/*.json) and prints a
+// PASS/FAIL line per fixture.
+func policyTest(args []string) int {
+    fs := flag.NewFlagSet("policy test", flag.ExitOnError)
+    dir := fs.String("dir", "policies", "policy directory")
+    _ = fs.Parse(args)
+    eng, err := ais.LoadPolicies(*dir)
+    if err != nil { fmt.Fprintln(os.Stderr, err); return 1 }
+    files := fs.Args()
+    if len(files) == 0 { files, _ = filepath.Glob(filepath.Join(*dir, "tests", "*.json")) }
+    if len(files) == 0 { fmt.Fprintln(os.Stderr, "no policy fixtures found"); return 1 }
+    failed := 0
+    for _, f := range files {
+        name, fails, err := ais.RunPolicyFixture(eng, f)
+        if err != nil { fails = []string{err.Error()} }
+        if len(fails) == 0 { fmt.Printf("[PASS] %s\n", name); continue }
+        failed++
+        fmt.Printf("[FAIL] %s\n", name)
+        for _, m := range fails { fmt.Printf("       %s\n", m) }
+    }
+    fmt.Printf("\nSummary: %d/%d passed\n", len(files)-failed, len(files))
+    if failed > 0 { return 1 }
+    return 0
+}
+
+// policyEval prints the external-policy-v1 evidence for one UIA/APA pair.
+func policyEval(args []string) int {
+    fs := flag.NewFlagSet("policy eval", flag.ExitOnError)
+    dir := fs.String("dir", "policies", "policy directory")
+    profile := fs.String("profile", "", "override uia.policyProfile")
+    uiaPath := fs.String("uia", "", "UIA JSON file")
+    apaPath := fs.String("apa", "", "APA JSON file")
+    _ = fs.Parse(args)
+    if *uiaPath == "" || *apaPath == "" { fmt.Fprintln(os.Stderr, usage); return 2 }
+    eng, err := ais.LoadPolicies(*dir)
+    if err != nil { fmt.Fprintln(os.Stderr, err); return 1 }
+    var uia ais.UIA
+    var apa ais.APA
+    for _, in := range []struct{ path string; v any }{{*uiaPath, &uia}, {*apaPath, &apa}} {
+        b, err := os.ReadFile(in.path)
+        if err == nil { err = json.Unmarshal(b, in.v) }
+        if err != nil { fmt.Fprintf(os.Stderr, "%s: %v\n", in.path, err); return 1 }
+    }
+    if *profile != "" { uia.PolicyProfile = *profile }
+    out, _ := json.MarshalIndent(map[string]any{"profile": uia.PolicyProfile, "evidence": eng.For(uia.PolicyProfile).Evaluate(uia, apa)}, "", "  ")
+    fmt.Println(string(out))
+    return 0
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+    "net/http"
+    "os"
+    "strings"
+    "time"
+
+    "ais-demo/internal/ais"
+)
+
+// approvals queues elevated steps that drew a needConsent challenge.
+var approvals *ais.Approvals
+
+func initApprovals() {
+    approvals = &ais.Approvals{
+        Secret: secret, ApproverSecret: []byte(envDefault("AIS_APPROVER_SECRET", "dev-approver-secret-change-me")),
+        TTL: 15 * time.Minute, ConsentTTL: 10 * time.Minute,
+        Authorize: requireRole, Audit: writeAudit,
+    }
+    if d, err := time.ParseDuration(os.Getenv("AIS_APPROVAL_TTL")); err == nil && d > 0 { approvals.TTL = d }
+    if d, err := time.ParseDuration(os.Getenv("AIS_CONSENT_TTL")); err == nil && d > 0 { approvals.ConsentTTL = d }
+    http.Handle("/api/approvals", http.StripPrefix("/api/approvals", approvals))
+    http.Handle("/api/approvals/", http.StripPrefix("/api/approvals", approvals))
+}
+
+// requireRole resolves the bearer token against AIS_ROLE_TOKENS
+// ("token=name:role,...") and reports the caller name if it holds one of roles.
+func requireRole(r *http.Request, roles ...string) (string, bool) {
+    tok := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+    if tok == "" { return "", false }
+    for _, entry := range splitCSV(envDefault("AIS_ROLE_TOKENS", "dev-approver-token=demo-approver:approver")) {
+        t, who, ok := strings.Cut(entry, "=")
+        if !ok || t != tok { continue }
+        name, role, _ := strings.Cut(who, ":")
+        if contains(roles, role) { return name, true }
+    }
+    return "", false
+}
@@ -4,18 +4,22 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"context"
+	"database/sql"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"os/exec"
 	"strings"
 	"time"
 
 	"ais-demo/internal/ais"
+	"ais-demo/internal/mcp"
     "go.opentelemetry.io/otel"
     "go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
     "go.opentelemetry.io/otel/sdk/resource"
@@ -28,10 +32,27 @@ var auditLog []string
 var auditNotify = make(chan struct{}, 1)
 var auditPath string
 var auditMaxLines = 1000
+var consentLevel = 3
+var webhooks *ais.WebhookDispatcher
+var pdp ais.PolicyDecisionPoint
+var minAlignment = 0.8
+var calibration *ais.Calibration
+var injection = ais.DefaultInjectionScanner()
+var dlp = ais.DefaultDLPScanner()
+var vault *ais.TokenVault
+var tools *ais.ToolRegistry
+// planner decomposes a UIA into an APA for the Re-Plan button.
+var planner ais.Planner
+var ledger = ais.NewLedger()
+// sqlDriver names the database/sql driver for sql.query; it is set when the
+// pure-Go SQLite driver is compiled in (-tags sqlite, see sqlite.go).
+var sqlDriver string
 
 func main() {
-    // Minimal OTel tracer provider (stdout)
-    if tp, err := initTracer(); err == nil { defer func(){ _ = tp.Shutdown(context.Background()) }() }
+    // `aisdemo mcp` serves the guarded tools over MCP stdio instead of HTTP
+    stdioMCP := len(os.Args) > 1 && os.Args[1] == "mcp"
+    // Minimal OTel tracer provider (stdout, or stderr when stdout carries MCP)
+    if tp, err := initTracer(stdioMCP); err == nil { defer func(){ _ = tp.Shutdown(context.Background()) }() }
 	secret = []byte(os.Getenv("AIS_SECRET"))
 	if len(secret) == 0 {
 		secret = []byte("dev-secret-change-me")
@@ -41,6 +62,130 @@ func main() {
 	if v := os.Getenv("AIS_AUDIT_MAXLINES"); v != "" {
 		_, _ = fmt.Sscanf(v, "%d", &auditMaxLines)
 	}
+	if v := os.Getenv("AIS_CONSENT_LEVEL"); v != "" {
+		_, _ = fmt.Sscanf(v, "%d", &consentLevel)
+	}
+	initApprovals()
+	embedThreshold := ais.DefaultEmbeddingThreshold
+	if v := os.Getenv("AIS_EMBED_THRESHOLD"); v != "" {
+		_, _ = fmt.Sscanf(v, "%g", &embedThreshold)
+	}
+	ais.RegisterVerifier(ais.EmbeddingVerifier{Client: &ais.OllamaClient{BaseURL: envDefault("OLLAMA_URL", "http://localhost:11434"), Model: envDefault("AIS_EMBED_MODEL", "nomic-embed-text"), HTTP: http.DefaultClient}, Threshold: embedThreshold})
+	judgeSeed := ais.DefaultJudgeSeed
+	if v := os.Getenv("AIS_JUDGE_SEED"); v != "" {
+		_, _ = fmt.Sscanf(v, "%d", &judgeSeed)
+	}
+	if v := os.Getenv("AIS_ENSEMBLE_METHODS"); v != "" {
+		ens := ais.EnsembleVerifier{Methods: splitCSV(v), Rule: envDefault("AIS_ENSEMBLE_RULE", ais.EnsembleMin), Weights: map[string]float64{}}
+		_, _ = fmt.Sscanf(os.Getenv("AIS_ENSEMBLE_K"), "%d", &ens.K)
+		for _, kv := range splitCSV(os.Getenv("AIS_ENSEMBLE_WEIGHTS")) {
+			m, w, _ := strings.Cut(kv, "=")
+			var f float64
+			if _, err := fmt.Sscanf(w, "%g", &f); err == nil { ens.Weights[m] = f }
+		}
+		ais.RegisterVerifier(ens)
+	}
+	ais.RegisterVerifier(ais.JudgeVerifier{Client: &ais.OllamaClient{BaseURL: envDefault("OLLAMA_URL", "http://localhost:11434"), Model: envDefault("AIS_JUDGE_MODEL", "llama3"), HTTP: http.DefaultClient}, Seed: judgeSeed, TrustSignedAPr: os.Getenv("AIS_JUDGE_TRUST_SIGNED") == "1"})
+	if dir := envDefault("AIS_POLICY_DIR", "policies"); dirExists(dir) {
+		eng, err := ais.LoadPolicies(dir)
+		if err != nil { log.Fatalf("policies: %v", err) }
+		ais.RegisterVerifier(ais.ExternalPolicyVerifier{Engine: eng})
+	}
+	if p := os.Getenv("AIS_WEBHOOKS"); p != "" {
+		d, err := ais.LoadWebhookDispatcher(p)
+		if err != nil { log.Fatalf("webhooks: %v", err) }
+		webhooks = d
+	}
+	if v := os.Getenv("AIS_MIN_ALIGNMENT"); v != "" {
+		_, _ = fmt.Sscanf(v, "%g", &minAlignment)
+	}
+	if p := os.Getenv("AIS_CALIBRATION"); p != "" {
+		c, err := ais.LoadCalibration(p)
+		if err != nil { log.Fatalf("calibration: %v", err) }
+		calibration = c
+	}
+	for _, kv := range splitCSV(os.Getenv("AIS_CALIBRATION_FLOORS")) {
+		p, f, _ := strings.Cut(kv, "=")
+		var floor float64
+		if _, err := fmt.Sscanf(f, "%g", &floor); err == nil { ais.SetProfileFloor(p, floor) }
+	}
+	if p := os.Getenv("AIS_INJECTION_RULES"); p != "" {
+		s, err := ais.LoadInjectionScanner(p)
+		if err != nil { log.Fatalf("injection rules: %v", err) }
+		injection = s
+	}
+	if os.Getenv("AIS_INJECTION") == "off" { injection = nil }
+	if p := os.Getenv("AIS_DLP_RULES"); p != "" {
+		s, err := ais.LoadDLPScanner(p)
+		if err != nil { log.Fatalf("dlp rules: %v", err) }
+		dlp = s
+	}
+	v, err := ais.OpenTokenVault(envDefault("AIS_VAULT_PATH", "vault.jsonl"), secret)
+	if err != nil { log.Fatalf("vault: %v", err) }
+	vault = v
+	switch v := os.Getenv("AIS_DLP"); v {
+	case "off":
+		dlp = nil
+	case ais.DLPBlock, ais.DLPRedact:
+		dlp.Action = v
+	}
+	httpTool := &ais.HTTPTool{HTTP: http.DefaultClient, Destinations: splitCSV(os.Getenv("AIS_HTTP_DESTINATIONS")), ContentTypes: splitCSV(os.Getenv("AIS_HTTP_CONTENT_TYPES"))}
+	if d, err := time.ParseDuration(os.Getenv("AIS_HTTP_TIMEOUT")); err == nil { httpTool.Timeout = d }
+	if v := os.Getenv("AIS_HTTP_MAX_BYTES"); v != "" {
+		_, _ = fmt.Sscanf(v, "%d", &httpTool.MaxBytes)
+	}
+	reg, err := ais.NewToolRegistry(httpTool, ais.GenerateTool{Client: ollamaClient})
+	if err != nil { log.Fatalf("tools: %v", err) }
+	if roots := splitCSV(os.Getenv("AIS_FILE_ROOTS")); len(roots) > 0 {
+		scope := &ais.FileScope{Roots: roots, Globs: splitCSV(os.Getenv("AIS_FILE_GLOBS")), DefaultLabels: splitCSV(envDefault("AIS_FILE_LABELS", "internal"))}
+		for _, t := range []ais.Tool{ais.FileReadTool{FileScope: scope}, ais.FileListTool{FileScope: scope}} {
+			if err := reg.Register(t); err != nil { log.Fatalf("tools: %v", err) }
+		}
+	}
+	if root := os.Getenv("AIS_WRITE_ROOT"); root != "" {
+		if err := reg.Register(ais.FileWriteTool{FileScope: &ais.FileScope{Roots: []string{root}, Globs: splitCSV(os.Getenv("AIS_WRITE_GLOBS"))}}); err != nil { log.Fatalf("tools: %v", err) }
+	}
+	if outbox := os.Getenv("AIS_OUTBOX"); outbox != "" {
+		if err := reg.Register(ais.EmailTool{Outbox: outbox, From: envDefault("AIS_EMAIL_FROM", "ais-demo@localhost"), Domains: splitCSV(os.Getenv("AIS_EMAIL_DOMAINS"))}); err != nil { log.Fatalf("tools: %v", err) }
+	}
+	if p := os.Getenv("AIS_SQL_DB"); p != "" {
+		if t, err := sqlTool(p); err != nil {
+			log.Printf("sql.query disabled: %v", err)
+		} else if err := reg.Register(t); err != nil { log.Fatalf("tools: %v", err) }
+	}
+	if p := os.Getenv("AIS_EXEC_CONFIG"); p != "" {
+		var eff ais.ExecEffects
+		b, err := os.ReadFile(p)
+		if err == nil { err = json.Unmarshal(b, &eff) }
+		if err != nil { log.Fatalf("exec config: %v", err) }
+		t, err := ais.NewExecTool(eff)
+		if err != nil { log.Fatalf("exec config: %v", err) }
+		if err := reg.Register(t); err != nil { log.Fatalf("tools: %v", err) }
+	}
+	// AIS_MCP_PROXY: downstream MCP servers whose tools are guarded as our own
+	for _, p := range splitCSV(os.Getenv("AIS_MCP_PROXY")) {
+		px, err := mcpProxy(p)
+		if err != nil { log.Fatalf("mcp proxy: %v", err) }
+		for _, t := range px.Tools() {
+			if err := reg.Register(t); err != nil { log.Fatalf("tools: %v", err) }
+		}
+	}
+	tools = reg
+	plannerSeed := ais.DefaultPlannerSeed
+	if v := os.Getenv("AIS_PLANNER_SEED"); v != "" {
+		_, _ = fmt.Sscanf(v, "%d", &plannerSeed)
+	}
+	planner = ais.OllamaPlanner{Client: &ais.OllamaClient{BaseURL: envDefault("OLLAMA_URL", "http://localhost:11434"), Model: envDefault("AIS_PLANNER_MODEL", envDefault("OLLAMA_MODEL", "llama3")), HTTP: http.DefaultClient}, Seed: plannerSeed}
+	if u := os.Getenv("AIS_OPA_URL"); u != "" {
+		opa := &ais.OPAClient{URL: u, Path: envDefault("AIS_OPA_PATH", "ais/authz"), Timeout: 2 * time.Second, CacheTTL: 30 * time.Second, HTTP: http.DefaultClient}
+		if d, err := time.ParseDuration(os.Getenv("AIS_OPA_TIMEOUT")); err == nil { opa.Timeout = d }
+		if d, err := time.ParseDuration(os.Getenv("AIS_OPA_CACHE_TTL")); err == nil { opa.CacheTTL = d }
+		pdp = opa
+	}
+	if stdioMCP {
+		if err := mcpServer().ServeStdio(context.Background(), os.Stdin, os.Stdout); err != nil { log.Fatalf("mcp: %v", err) }
+		return
+	}
 
     // Model status endpoints and UI
     http.HandleFunc("/model/status", handleModelStatus)
@@ -55,8 +200,12 @@ func main() {
 	http.HandleFunc("/execute", handleExecute)
     http.HandleFunc("/api/chat/send", handleChatSend)
     http.HandleFunc("/api/chat/plan", handlePlan)
+    http.HandleFunc("/api/agent/run", handleAgentRun)
     http.HandleFunc("/api/consent/mint", handleConsentMint)
     http.HandleFunc("/api/chat/crosscheck", handleCrossCheck)
+    http.HandleFunc("/api/revoke", handleRevoke)
+    http.HandleFunc("/api/detokenize", handleDetokenize)
+    http.Handle("/mcp", mcpServer())
 
 	log.Println("AIS demo on http://localhost:8890")
 	log.Fatal(http.ListenAndServe(":8890", nil))
@@ -421,6 +570,27 @@ function needConfirmIntent(prompt){
   return risky.some(k => prompt.toLowerCase().includes(k));
 }
 
+// postGuarded posts to a guarded endpoint; needConsent challenges are queued
+// server-side, so retry until the step runs. Only approvers may read
+// approvals: a retry that names another approval means ours was denied or
+// expired.
+async function postGuarded(url, body){
+  let waiting = null;
+  while(true){
+    const r = await fetch(url, { method:'POST', headers:{'content-type':'application/json'}, body: JSON.stringify(body)});
+    if(r.status !== 403) return r;
+    const txt = await r.text();
+    let e = null; try { e = JSON.parse(txt); } catch(_){ }
+    if(!e || e.Code !== 'AUTHZ-NEED-CONSENT' || !e.Details || !e.Details.approval){
+      return new Response(txt, {status: r.status});
+    }
+    const id = e.Details.approval;
+    if(waiting && id !== waiting){ return new Response('Approval '+waiting+' was not granted', {status: 403}); }
+    if(!waiting){ addMsg('assistant', 'Awaiting approval '+id+' …'); waiting = id; }
+    await new Promise(res=>setTimeout(res, 3000));
+  }
+}
+
 async function send(){
   const ta = document.getElementById('input');
   const text = ta.value.trim();
@@ -447,7 +617,7 @@ async function send(){
 
   const body = { messages: msgs, uia: currentIntent };
   try{
-    const r = await fetch('/api/chat/send', { method:'POST', headers:{'content-type':'application/json'}, body: JSON.stringify(body)});
+    const r = await postGuarded('/api/chat/send', body);
     if(!r.ok){ addMsg('assistant', 'Error: '+await r.text()); return }
     const j = await r.json();
     showIntent(j.uia, j.apa, j.apr);
@@ -461,26 +631,50 @@ async function send(){
 
 async function runAgent(){
   if(document.getElementById('loadingOverlay').style.display==='flex'){ return }
-  // Simulate a 3-step agent plan; each step goes through intent→APA/APr→IBE guard
+  // One intent and one plan for the whole chain; the server guards each step
+  // with its own IBE and streams progress back
   let steps = [];
   try { steps = JSON.parse(stepsEd.getValue()); } catch(e) { alert('Invalid steps JSON'); return }
-  let ctx = msgs.map(m => (m.role+': '+m.content)).join('\n');
-  for(let i=0;i<steps.length;i++){
-    const s = steps[i];
-    const uia = { "@type":"UIA", id:'urn:uia:'+Date.now()+':'+i, subject:{id:'user:demo'}, purpose:'Agent step '+(i+1)+': '+(s.prompt||s.url||s.tool), constraints:{dataClasses:['internal','derived'], timeWindow:{notAfter:new Date(Date.now()+10*60*1000).toISOString()}}, riskBudget:{level:1, maxWrites:0, maxRecords:1000, maxExternalCalls: (s.tool==='http.get'?1:0)}, policyProfile:'agent-readonly', proof:{} };
-    showIntent(uia, {info:'planning step '+(i+1)+'…'}, {info:'pending…'});
-    let r;
-    if(s.tool==='http.get'){
-      r = await fetch('/api/chat/send', { method:'POST', headers:{'content-type':'application/json'}, body: JSON.stringify({messages:[{role:'user', content:'Fetch URL: '+s.url}], uia, tool:'http.get', url:s.url})});
-    } else {
-      const body = { messages: [{role:'user', content: ctx+'\n\nTask: '+s.prompt}], uia };
-      r = await fetch('/api/chat/send', { method:'POST', headers:{'content-type':'application/json'}, body: JSON.stringify(body)});
+  const transcript = msgs.map(m => (m.role+': '+m.content)).join('\n');
+  const planSteps = steps.map((s, i) => {
+    const id = s.id || ('s'+(i+1));
+    let args = s.args;
+    if(!args && s.tool === 'http.get'){ args = {url: s.url}; }
+    if(!args){
+      const prev = i > 0 ? 'Previous result:\n${steps.'+(steps[i-1].id || ('s'+i))+'.output}' : transcript;
+      args = {prompt: prev+'\n\nTask: '+s.prompt};
     }
-    if(!r.ok){ addMsg('assistant', 'Step '+(i+1)+' error: '+await r.text()); return }
-    const j = await r.json();
-    showIntent(j.uia, j.apa, j.apr);
-    addMsg('assistant', '(step '+(i+1)+') '+j.assistant);
-    ctx += '\nAssistant: '+j.assistant;
+    return {id, tool: s.tool || 'ollama.generate', args, when: s.when, after: s.after};
+  });
+  const purpose = 'Agent: '+steps.map(s => s.prompt||s.url||s.tool).join('; ').slice(0,200);
+  const uia = { "@type":"UIA", id:'urn:uia:'+Date.now(), subject:{id:'user:demo'}, purpose, constraints:{dataClasses:['internal','derived'], timeWindow:{notAfter:new Date(Date.now()+10*60*1000).toISOString()}}, riskBudget:{level:1, maxWrites:0, maxRecords:1000, maxExternalCalls: planSteps.filter(s => s.tool==='http.get').length}, policyProfile:'agent-readonly', proof:{} };
+  showIntent(uia, {info:'planning '+planSteps.length+' steps…'}, {info:'pending…'});
+  const r = await fetch('/api/agent/run', { method:'POST', headers:{'content-type':'application/json'}, body: JSON.stringify({uia, apa:{steps: planSteps}})});
+  if(!r.ok){ addMsg('assistant', 'Agent error: '+await r.text()); return }
+  const reader = r.body.getReader();
+  const dec = new TextDecoder();
+  let buf = '';
+  while(true){
+    const {value, done} = await reader.read();
+    if(done) break;
+    buf += dec.decode(value, {stream: true});
+    let i;
+    while((i = buf.indexOf('\n\n')) >= 0){
+      const chunk = buf.slice(0, i);
+      buf = buf.slice(i+2);
+      if(chunk.startsWith('data: ')){ try { agentEvent(JSON.parse(chunk.slice(6))); } catch(_){ } }
+    }
+  }
+}
+
+function agentEvent(ev){
+  switch(ev.event){
+  case 'plan': showIntent(ev.uia, ev.apa, ev.apr); break;
+  case 'step.approval': addMsg('assistant', 'Step '+ev.step+' awaiting approval '+ev.details.approval+' …'); break;
+  case 'step.done': addMsg('assistant', '('+ev.step+') '+ev.output); break;
+  case 'step.skip': addMsg('assistant', 'Step '+ev.step+' skipped: '+ev.message); break;
+  case 'step.deny':
+  case 'step.error': addMsg('assistant', 'Step '+ev.step+' '+ev.code+': '+ev.message); break;
   }
 }
 
@@ -536,6 +730,10 @@ func handleConfirm(w http.ResponseWriter, r *http.Request) {
 	purpose := r.FormValue("purpose")
     classes := r.FormValue("dataclasses")
 	prompt := r.FormValue("prompt")
+	// The executed prompt is form input, not the APA step the guard scans
+	if injection != nil {
+		if f := injection.Scan("prompt", prompt); injection.Blocked(f) { writeJSONError(w, 403, "INPUT-PROMPT-INJECTION", "prompt injection detected", map[string]any{"findings": f}); return }
+	}
 
     dc := splitCSV(classes)
     // Ensure 'derived' is permitted for generated content in this demo
@@ -566,9 +764,7 @@ func handleConfirm(w http.ResponseWriter, r *http.Request) {
 		Proof: map[string]any{},
 	}
 	// Compute deterministic alignment evidence and reflect it in APr and step alignment
-	cov, risk := ais.VerifyAlignment(uia, apa)
-	apa.Steps[0].Alignment.Score = cov
-	apr := ais.APr{Type: "APr", ID: nowID(), UIA: uia.ID, APA: apa.ID, Method: "semantic-entailment-v1", Evidence: ais.APrEvidence{Coverage: cov, Risk: risk}, Proof: map[string]any{}}
+	apr := proveAlignment(uia, &apa)
 
 	// Sign UIA
 	if j, err := ais.SignJWSObject(secret, uia); err == nil { if uia.Proof == nil { uia.Proof = map[string]any{} }; uia.Proof["jws"] = j }
@@ -597,9 +793,8 @@ func handleExecute(w http.ResponseWriter, r *http.Request) {
 	_ = json.Unmarshal([]byte(r.FormValue("uia")), &uia)
 	_ = json.Unmarshal([]byte(r.FormValue("apa")), &apa)
 	_ = json.Unmarshal([]byte(r.FormValue("apr")), &apr)
-	prompt := r.FormValue("prompt")
-
-	tca := ais.TCA{ID: "urn:tca:ollama.generate@1", Operations: []ais.TCAOperation{{Name: "ollama.generate", Effects: ais.OperationEffects{Writes: 0, DataClasses: []string{"derived"}}}}, Operator: "local"}
+	tool, _ := tools.Lookup("ollama.generate")
+	tca := tool.TCA()
 
     ibe := ais.IBE{Type: "IBE", ID: "urn:ibe:" + nowID(), UIARef: uia.ID, APAStepRef: "s1", APrRef: apr.ID, TCARef: tca.ID, Nonce: nowID(), Exp: time.Now().Add(2 * time.Minute)}
     ibeForSig := ibe
@@ -607,28 +802,151 @@ func handleExecute(w http.ResponseWriter, r *http.Request) {
     sig, _ := ais.SignJWSObject(secret, ibeForSig)
     ibe.Sig = sig
 
-    if err := ais.VerifyIBE(ais.GuardConfig{Secret: secret, MinAlignment: 0.8, VerifierMethod: "semantic-entailment-v1"}, ibe, apr, uia, apa, tca); err != nil {
-        writeJSONError(w, 403, err.Error(), "blocked by guard", map[string]any{"ibe": ibe.ID})
+    if err := ais.VerifyIBEContext(r.Context(), guardConfig(), ibe, apr, uia, apa, tca); err != nil {
+        writeGuardError(w, err, ibe, uia, apa, apr)
 		return
 	}
-
-	client := &ais.OllamaClient{BaseURL: envDefault("OLLAMA_URL", "http://localhost:11434"), Model: envDefault("OLLAMA_MODEL", "llama3"), HTTP: http.DefaultClient}
-    // If model is still missing (e.g., first-time), trigger pull via UI route
-    if ok, _ := client.HasModel(); !ok {
-        writeJSONError(w, 409, "MODEL-NOT-PRESENT", "model not present yet; please wait for pull to complete", nil)
+    hold, err := ledger.Reserve(uia, apa.Steps[0].Expected.Writes)
+    if err != nil {
+        writeGuardError(w, err, ibe, uia, apa, apr)
         return
     }
-	resp, err := client.Generate(prompt)
+
+    // Execute the guarded step's args, not the echoed form prompt
+    res, err := invokeStep(r.Context(), tool, hold, apa, "s1", apr)
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		writeToolError(w, err)
 		return
 	}
+	resp, extra, ok := checkResult(w, "ollama.generate", res.Output, ibe, uia, apa, apr)
+	if !ok { return }
+	resp = ais.ApplyObligations(apr.Evidence.Obligations, resp)
     // audit event for legacy execute path
-    writeAudit(map[string]any{"ts": time.Now().UTC().Format(time.RFC3339), "uia": uia.ID, "apa": apa.ID, "ibe": ibe.ID, "tool": "ollama.generate", "ok": true, "resultHash": hashText(resp)})
+    ev := map[string]any{"ts": time.Now().UTC().Format(time.RFC3339), "uia": uia.ID, "apa": apa.ID, "ibe": ibe.ID, "tool": "ollama.generate", "ok": true, "resultHash": hashText(resp)}
+    for k, v := range extra { ev[k] = v }
+    writeAudit(ev)
 	w.Header().Set("content-type", "text/plain")
 	_, _ = w.Write([]byte(resp))
 }
 
+// invokeStep runs the APA step through its registered tool with the APr
+// obligations and the record limit of hold, the step's ledger reservation,
+// attached to the context, and settles hold with the writes and records it
+// performed.
+func invokeStep(ctx context.Context, tool ais.Tool, hold *ais.Reservation, apa ais.APA, stepRef string, apr ais.APr) (ais.Result, error) {
+    for _, s := range apa.Steps {
+        if s.ID != stepRef { continue }
+        ctx, span := otel.Tracer("aisdemo").Start(ctx, tool.Name())
+        defer span.End()
+        ctx = ais.WithRecordLimit(ais.WithObligations(ctx, apr.Evidence.Obligations), hold.Records())
+        res, err := tool.Invoke(ctx, s.Args)
+        hold.Settle(res)
+        return res, err
+    }
+    hold.Release()
+    return ais.Result{}, fmt.Errorf("step %s not found", stepRef)
+}
+
+// writeToolError maps tool failures: a missing model is 409, membrane
+// violations found during execution are 403, upstream failures 502 and
+// anything else is retryable.
+func writeToolError(w http.ResponseWriter, err error) {
+    status, code, msg, details := toolError(err)
+    writeJSONError(w, status, code, msg, details)
+}
+
+// toolError gives the HTTP status, error code, message and details for a
+// tool failure.
+func toolError(err error) (int, string, string, map[string]any) {
+    var se *ais.HTTPStatusError
+    var ee *ais.ExecExitError
+    var re *mcp.RemoteError
+    switch {
+    case errors.Is(err, ais.ErrModelNotPresent):
+        return 409, "MODEL-NOT-PRESENT", "model not present yet; please wait for pull to complete", nil
+    case errors.Is(err, ais.ErrDestinationNotAllowed):
+        return 403, ais.ErrDestinationNotAllowed.Error(), err.Error(), nil
+    case errors.Is(err, ais.ErrRecordsExceeded):
+        return 403, ais.ErrRecordsExceeded.Error(), "no records left in the risk budget", nil
+    case errors.Is(err, ais.ErrRedirectRefused):
+        return 403, ais.ErrRedirectRefused.Error(), err.Error(), nil
+    case errors.Is(err, ais.ErrContentTypeNotAllowed):
+        return 502, ais.ErrContentTypeNotAllowed.Error(), err.Error(), nil
+    case errors.As(err, &se):
+        return 502, "TOOL-UPSTREAM-STATUS", err.Error(), map[string]any{"status": se.Status, "location": se.Location}
+    case errors.As(err, &ee):
+        return 502, "TOOL-EXIT-STATUS", err.Error(), map[string]any{"exitCode": ee.Code, "signal": ee.Signal, "stderr": ee.Stderr}
+    case errors.As(err, &re):
+        return 502, "TOOL-REMOTE-ERROR", err.Error(), map[string]any{"tool": re.Tool}
+    case errors.Is(err, context.DeadlineExceeded):
+        return 504, "SYS-RETRY", err.Error(), nil
+    }
+    return 500, "SYS-RETRY", err.Error(), nil
+}
+
+// sqlTool opens the AIS_SQL_DB database read-only for sql.query, with column
+// labels from the AIS_SQL_LABELS JSON file ({"table.column": ["pii"]}).
+func sqlTool(path string) (ais.SQLTool, error) {
+    if sqlDriver == "" { return ais.SQLTool{}, errors.New("built without a SQLite driver (go build -tags sqlite)") }
+    db, err := sql.Open(sqlDriver, ais.SQLiteReadOnlyDSN(path))
+    if err != nil { return ais.SQLTool{}, err }
+    if err := db.Ping(); err != nil { return ais.SQLTool{}, err }
+    t := ais.SQLTool{DB: db, DefaultLabels: splitCSV(envDefault("AIS_SQL_DEFAULT_LABELS", "internal"))}
+    if p := os.Getenv("AIS_SQL_LABELS"); p != "" {
+        b, err := os.ReadFile(p)
+        if err != nil { return ais.SQLTool{}, err }
+        if err := json.Unmarshal(b, &t.Columns); err != nil { return ais.SQLTool{}, fmt.Errorf("%s: %w", p, err) }
+    }
+    if v := os.Getenv("AIS_SQL_MAX_ROWS"); v != "" {
+        _, _ = fmt.Sscanf(v, "%d", &t.MaxRows)
+    }
+    return t, nil
+}
+
+// mcpServer exposes the registered tools over MCP behind the guard; consent
+// challenges queue the step for approval as they do over HTTP.
+func mcpServer() *mcp.Server {
+    return &mcp.Server{Name: "ais-demo", Version: "0.1.0", AllowedOrigins: splitCSV(os.Getenv("AIS_MCP_ORIGINS")), Handler: &mcp.GuardedTools{
+        Tools: tools, Config: guardConfig, Audit: writeAudit, Challenge: approvals.Challenge,
+    }}
+}
+
+// planExecutor runs multi-step plans behind the guard; consent challenges
+// queue the step and the run waits for the decision.
+func planExecutor() *ais.Executor {
+    return &ais.Executor{
+        Tools: tools, Config: guardConfig, Audit: writeAudit,
+        Challenge: approvals.Challenge, AwaitConsent: approvals.Await,
+        ToolError: func(err error) (string, map[string]any) {
+            _, code, _, details := toolError(err)
+            return code, details
+        },
+    }
+}
+
+// mcpProxy starts the downstream server a ProxyConfig file describes and
+// builds its TCA from the tools it lists.
+func mcpProxy(path string) (*mcp.Proxy, error) {
+    pc, err := mcp.LoadProxyConfig(path)
+    if err != nil { return nil, err }
+    if len(pc.Command) == 0 { return nil, fmt.Errorf("%s: command is required", path) }
+    cmd := exec.Command(pc.Command[0], pc.Command[1:]...)
+    cmd.Env = append(os.Environ(), pc.Env...)
+    cmd.Stderr = os.Stderr
+    ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+    defer cancel()
+    c, err := mcp.StartClient(ctx, cmd)
+    if err != nil { return nil, err }
+    px, err := mcp.NewProxy(ctx, c, pc)
+    if err != nil { _ = c.Close(); return nil, err }
+    log.Printf("mcp proxy: %s exposes %d tools under %s", pc.Server, len(px.Tools()), px.TCA().ID)
+    return px, nil
+}
+
+func ollamaClient() *ais.OllamaClient {
+    return &ais.OllamaClient{BaseURL: envDefault("OLLAMA_URL", "http://localhost:11434"), Model: envDefault("OLLAMA_MODEL", "llama3"), HTTP: http.DefaultClient}
+}
+
 func nowID() string {
 	b := make([]byte, 8)
 	_, _ = rand.Read(b)
@@ -656,11 +974,133 @@ func trimSpace(s string) string {
 	return s
 }
 
+func dirExists(p string) bool {
+    fi, err := os.Stat(p)
+    return err == nil && fi.IsDir()
+}
+
 func envDefault(k, v string) string {
 	if x := os.Getenv(k); x != "" { return x }
 	return v
 }
 
+// guardConfig returns the guard settings shared by all enforcement paths.
+func guardConfig() ais.GuardConfig {
+    return ais.GuardConfig{
+        Secret: secret, MinAlignment: minAlignment, Calibration: calibration,
+        ConsentLevel: consentLevel, ElevatedTools: splitCSV(envDefault("AIS_ELEVATED_TOOLS", "http.get")),
+        ApproverSecret: approvals.ApproverSecret, Consent: approvals.Consent,
+        PDP: pdp, Injection: injection, DLP: dlp, Tools: tools, Ledger: ledger,
+        Redactor: &ais.Redactor{Scanner: dlp, Vault: vault},
+    }
+}
+
+// proveAlignment computes APr evidence with the verifier registered for
+// AIS_APR_METHOD and reflects the coverage in the step alignment scores.
+func proveAlignment(uia ais.UIA, apa *ais.APA) ais.APr {
+    method := envDefault("AIS_APR_METHOD", "semantic-entailment-v1.1")
+    v, ok := ais.LookupVerifier(method)
+    if !ok { v = ais.SemanticEntailmentV11Verifier{} }
+    ev := v.Verify(uia, *apa)
+    for i := range apa.Steps {
+        for _, se := range ev.Steps {
+            if se.Step == apa.Steps[i].ID { apa.Steps[i].Alignment = ais.StepAlignment{Score: se.Score, Why: se.Reason} }
+        }
+    }
+    return ais.APr{Type: "APr", ID: nowID(), UIA: uia.ID, APA: apa.ID, Method: v.Method(), Evidence: ev, Proof: map[string]any{}}
+}
+
+// writeGuardError reports a guard denial; needConsent challenges queue the
+// step for human approval and return the approval id to poll.
+func writeGuardError(w http.ResponseWriter, err error, ibe ais.IBE, uia ais.UIA, apa ais.APA, apr ais.APr) {
+    if err.Error() == "AUTHZ-NEED-CONSENT" {
+        for _, s := range apa.Steps {
+            if s.ID != ibe.APAStepRef { continue }
+            a := approvals.Queue(uia, apa, apr, s)
+            writeJSONError(w, 403, err.Error(), "step requires approval", map[string]any{"ibe": ibe.ID, "approval": a.ID, "expires": a.ExpiresAt})
+            return
+        }
+    }
+    ev := map[string]any{"ts": time.Now().UTC().Format(time.RFC3339), "event": "guard.deny", "code": err.Error(), "uia": uia.ID, "apa": apa.ID, "apr": apr.ID, "ibe": ibe.ID, "tca": ibe.TCARef, "step": ibe.APAStepRef, "ok": false}
+    for _, s := range apa.Steps { if s.ID == ibe.APAStepRef { ev["tool"] = s.Tool } }
+    details := map[string]any{"ibe": ibe.ID}
+    var pd *ais.PolicyDenyError
+    if errors.As(err, &pd) { ev["reasons"], details["reasons"] = pd.Reasons, pd.Reasons }
+    var inj *ais.InjectionError
+    if errors.As(err, &inj) { ev["findings"], details["findings"] = inj.Findings, inj.Findings }
+    var de *ais.DLPError
+    if errors.As(err, &de) { ev["dlp"], details["dlp"] = de.Report, de.Report }
+    var pe *ais.PlanError
+    if errors.As(err, &pe) { ev["reason"], details["reason"] = pe.Reason, pe.Reason }
+    writeAudit(ev)
+    writeJSONError(w, 403, err.Error(), "blocked by guard", details)
+}
+
+// checkResult runs the result-side checks (injection scan, redaction
+// obligations, DLP) on tool output. On a block it writes the guard.deny audit
+// event and a 403, and returns false; audit holds the "redaction" and "dlp"
+// fields for the event.
+func checkResult(w http.ResponseWriter, tool, out string, ibe ais.IBE, uia ais.UIA, apa ais.APA, apr ais.APr) (string, map[string]any, bool) {
+    out, rep, err := ais.CheckResult(guardConfig(), tool, uia, apr, out)
+    var inj *ais.InjectionError
+    var de *ais.DLPError
+    if errors.As(err, &inj) || errors.As(err, &de) { writeGuardError(w, err, ibe, uia, apa, apr); return "", nil, false }
+    if err != nil { writeJSONError(w, 500, "SYS-RETRY", err.Error(), nil); return "", nil, false }
+    audit := map[string]any{}
+    rep.AddTo(audit)
+    return out, audit, true
+}
+
+// handleDetokenize reverses vault tokens for the detokenizer and admin
+// roles, given a list of tokens or a text containing them. Values are never
+// written to the audit log, only the tokens and who asked.
+func handleDetokenize(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost { writeJSONError(w, 405, "INPUT-METHOD-NOT-ALLOWED", "post only", nil); return }
+    who, ok := requireRole(r, "detokenizer", "admin")
+    if !ok { writeJSONError(w, 401, "AUTHZ-ROLE-REQUIRED", "detokenizer or admin role required", nil); return }
+    var p struct{ Tokens []string `json:"tokens"`; Text string `json:"text"`; UIA string `json:"uia"` }
+    if err := json.NewDecoder(r.Body).Decode(&p); err != nil || len(p.Tokens) == 0 && p.Text == "" {
+        writeJSONError(w, 400, "INPUT-BAD-JSON", "tokens or text required", nil)
+        return
+    }
+    toks := append(p.Tokens, ais.TokenPattern.FindAllString(p.Text, -1)...)
+    values := map[string]string{}
+    unknown := []string{}
+    for _, t := range toks {
+        e, err := vault.Detokenize(t)
+        // tokens of other intents are reported as unknown when a UIA is given
+        if err != nil || p.UIA != "" && e.UIA != p.UIA { unknown = append(unknown, t); continue }
+        values[t] = e.Value
+    }
+    text := ais.TokenPattern.ReplaceAllStringFunc(p.Text, func(t string) string {
+        if v, ok := values[t]; ok { return v }
+        return t
+    })
+    writeAudit(map[string]any{"ts": time.Now().UTC().Format(time.RFC3339), "event": "vault.detokenize", "by": who, "uia": p.UIA, "tokens": toks, "resolved": len(values)})
+    w.Header().Set("content-type", "application/json")
+    resp := map[string]any{"values": values, "unknown": unknown}
+    if p.Text != "" { resp["text"] = text }
+    _ = json.NewEncoder(w).Encode(resp)
+}
+
+// handleRevoke adds a UIA or APA to the in-memory CRL.
+func handleRevoke(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost { writeJSONError(w, 405, "INPUT-METHOD-NOT-ALLOWED", "post only", nil); return }
+    who, ok := requireRole(r, "approver", "admin")
+    if !ok { writeJSONError(w, 401, "AUTHZ-ROLE-REQUIRED", "approver or admin role required", nil); return }
+    var p struct{ Type string `json:"type"`; ID string `json:"id"`; Reason string `json:"reason"`; Minutes int `json:"minutes"` }
+    if err := json.NewDecoder(r.Body).Decode(&p); err != nil || p.ID == "" || (p.Type != "UIA" && p.Type != "APA") {
+        writeJSONError(w, 400, "INPUT-BAD-JSON", "type (UIA|APA) and id required", nil)
+        return
+    }
+    // without minutes the revocation holds until restart, past any artifact's exp
+    var until time.Time
+    if p.Minutes > 0 { until = time.Now().Add(time.Duration(p.Minutes) * time.Minute) }
+    ais.Revoke(p.ID, p.Reason, until)
+    writeAudit(map[string]any{"ts": time.Now().UTC().Format(time.RFC3339), "event": strings.ToLower(p.Type) + ".revoked", strings.ToLower(p.Type): p.ID, "by": who, "reason": p.Reason})
+    w.WriteHeader(204)
+}
+
 type errBody struct{ Code, Message string; Details map[string]any }
 func writeJSONError(w http.ResponseWriter, status int, code, msg string, details map[string]any) {
     w.Header().Set("content-type", "application/json")
@@ -684,6 +1124,9 @@ type chatReq struct {
 	UIA      ais.UIA     `json:"uia"`
     Tool     string      `json:"tool"`
     URL      string      `json:"url"`
+    // Args are the step args for Tool; without them ollama.generate gets the
+    // transcript as prompt and http.get gets URL.
+    Args     map[string]any `json:"args"`
 }
 type chatResp struct {
 	Assistant string   `json:"assistant"`
@@ -716,54 +1159,63 @@ func handleChatSend(w http.ResponseWriter, r *http.Request) {
         }
     }
     prompt := sb.String()
-    step := ais.APAStep{ID: "s1", Tool: "ollama.generate", Args: map[string]any{"prompt": prompt}, Expected: ais.StepExpected{DataClasses: []string{"derived"}, Writes: 0}, Alignment: ais.StepAlignment{Score: 0.0, Why: "semantic entailment"}}
-    if req.Tool == "http.get" {
-        step = ais.APAStep{ID: "s1", Tool: "http.get", Args: map[string]any{"url": req.URL}, Expected: ais.StepExpected{DataClasses: []string{"derived"}, Writes: 0}, Alignment: ais.StepAlignment{Score: 0.0, Why: "semantic entailment"}}
+    if req.Tool == "" { req.Tool = "ollama.generate" }
+    tool, ok := tools.Lookup(req.Tool)
+    if !ok {
+        writeJSONError(w, 400, "INPUT-SCHEMA-INVALID", "unknown tool", map[string]any{"tool": req.Tool, "tools": tools.Tools()})
+        return
     }
-    apa := ais.APA{Type: "APA", ID: nowID(), UIA: req.UIA.ID, Model: ais.ModelInfo{Hash: "ollama-local"}, Steps: []ais.APAStep{step}, Totals: ais.APATotals{PredictedWrites: 0, PredictedRecords: 1, PredictedExternalCalls: 0}, Proof: map[string]any{}}
-    cov, risk := ais.VerifyAlignment(req.UIA, apa)
-    apa.Steps[0].Alignment.Score = cov
-	apr := ais.APr{Type: "APr", ID: nowID(), UIA: req.UIA.ID, APA: apa.ID, Method: "semantic-entailment-v1", Evidence: ais.APrEvidence{Coverage: cov, Risk: risk}, Proof: map[string]any{}}
-
-    tca := ais.TCA{ID: "urn:tca:ollama.generate@1", Operations: []ais.TCAOperation{{Name: "ollama.generate", Effects: ais.OperationEffects{Writes: 0, DataClasses: []string{"derived"}}}}, Operator: "local"}
-    if req.Tool == "http.get" {
-        tca = ais.TCA{ID: "urn:tca:http.get@1", Operations: []ais.TCAOperation{{Name: "http.get", Effects: ais.OperationEffects{Writes: 0, DataClasses: []string{"derived"}}}}, Operator: "local"}
+    args := req.Args
+    if args == nil {
+        args = map[string]any{"prompt": prompt}
+        if req.Tool == "http.get" { args = map[string]any{"url": req.URL} }
     }
+    // the step expects the writes its TCA declares for the operation
+    tca := tool.TCA()
+    writes := 0
+    for _, op := range tca.Operations { if op.Name == tool.Name() { writes = op.Effects.Writes } }
+    step := ais.APAStep{ID: "s1", Tool: tool.Name(), Args: args, Expected: ais.StepExpected{DataClasses: []string{"derived"}, Writes: writes}, Alignment: ais.StepAlignment{Score: 0.0, Why: "semantic entailment"}}
+    apa := ais.APA{Type: "APA", UIA: req.UIA.ID, Model: ais.ModelInfo{Hash: "ollama-local"}, Steps: []ais.APAStep{step}, Totals: ais.APATotals{PredictedWrites: writes, PredictedRecords: 1, PredictedExternalCalls: 0}, Proof: map[string]any{}}
+    // a retry of the same request plans the same APA, so an approval granted
+    // for it applies
+    b, _ := json.Marshal(apa)
+    apa.ID = "urn:apa:" + hashText(string(b))[:16]
+    apr := proveAlignment(req.UIA, &apa)
+
 	ibe := ais.IBE{Type: "IBE", ID: "urn:ibe:" + nowID(), UIARef: req.UIA.ID, APAStepRef: "s1", APrRef: apr.ID, TCARef: tca.ID, Nonce: nowID(), Exp: time.Now().Add(2 * time.Minute)}
 	ibeForSig := ibe
 	ibeForSig.Sig = ""
     sig, _ := ais.SignJWSObject(secret, ibeForSig)
 	ibe.Sig = sig
 
-    if err := ais.VerifyIBE(ais.GuardConfig{Secret: secret, MinAlignment: 0.8, VerifierMethod: "semantic-entailment-v1"}, ibe, apr, req.UIA, apa, tca); err != nil {
-        writeJSONError(w, 403, err.Error(), "blocked by guard", map[string]any{"ibe": ibe.ID})
+    if err := ais.VerifyIBEContext(ctx, guardConfig(), ibe, apr, req.UIA, apa, tca); err != nil {
+        writeGuardError(w, err, ibe, req.UIA, apa, apr)
         return
     }
-    var respText string
-    var err error
-    if req.Tool == "http.get" {
-        httpTool := &ais.HTTPTool{HTTP: http.DefaultClient}
-        respText, err = httpTool.Get(req.URL)
-    } else {
-        client := &ais.OllamaClient{BaseURL: envDefault("OLLAMA_URL", "http://localhost:11434"), Model: envDefault("OLLAMA_MODEL", "llama3"), HTTP: http.DefaultClient}
-        if ok, _ := client.HasModel(); !ok {
-            writeJSONError(w, 409, "MODEL-NOT-PRESENT", "model not present yet; please wait for pull to complete", nil)
-            return
-        }
-        _, child := tracer.Start(ctx, "ollama.generate")
-        respText, err = client.Generate(prompt)
-        child.End()
+    hold, err := ledger.Reserve(req.UIA, apa.Steps[0].Expected.Writes)
+    if err != nil {
+        writeGuardError(w, err, ibe, req.UIA, apa, apr)
+        return
     }
+    res, err := invokeStep(ctx, tool, hold, apa, "s1", apr)
     if err != nil {
-        writeJSONError(w, 500, "SYS-RETRY", err.Error(), nil)
+        writeToolError(w, err)
         return
     }
+    // Fetched content is untrusted: refuse to hand injected instructions back to the chat
+    respText, extra, ok := checkResult(w, step.Tool, res.Output, ibe, req.UIA, apa, apr)
+    if !ok { return }
+    respText = ais.ApplyObligations(apr.Evidence.Obligations, respText)
     // audit event (hash-friendly minimal fields)
-    writeAudit(map[string]any{"ts": time.Now().UTC().Format(time.RFC3339), "uia": req.UIA.ID, "apa": apa.ID, "ibe": ibe.ID, "tool": step.Tool, "ok": true, "resultHash": hashText(respText)})
+    ev := map[string]any{"ts": time.Now().UTC().Format(time.RFC3339), "uia": req.UIA.ID, "apa": apa.ID, "ibe": ibe.ID, "tool": step.Tool, "ok": true, "resultHash": hashText(respText), "result": res.Meta, "writes": res.Writes, "records": res.Records, "spent": ledger.Usage(req.UIA.ID)}
+    for k, v := range extra { ev[k] = v }
+    writeAudit(ev)
 	w.Header().Set("content-type", "application/json")
 	_ = json.NewEncoder(w).Encode(chatResp{Assistant: respText, UIA: req.UIA, APA: apa, APr: apr})
 }
 
+// handlePlan asks the planner for an APA for the UIA and proves it; no tool
+// runs.
 func handlePlan(w http.ResponseWriter, r *http.Request) {
     var req struct{ UIA ais.UIA `json:"uia"` }
     if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -771,11 +1223,11 @@ func handlePlan(w http.ResponseWriter, r *http.Request) {
         return
     }
     // Build a plan (APA/APr) without executing tools
-    step := ais.APAStep{ID: "s1", Tool: "ollama.generate", Args: map[string]any{"prompt": "planned"}, Expected: ais.StepExpected{DataClasses: []string{"derived"}, Writes: 0}, Alignment: ais.StepAlignment{Score: 0.0, Why: "semantic entailment"}}
-    apa := ais.APA{Type: "APA", ID: nowID(), UIA: req.UIA.ID, Model: ais.ModelInfo{Hash: "ollama-local"}, Steps: []ais.APAStep{step}, Totals: ais.APATotals{PredictedWrites: 0, PredictedRecords: 1, PredictedExternalCalls: 0}, Proof: map[string]any{}}
-    cov, risk := ais.VerifyAlignment(req.UIA, apa)
-    apa.Steps[0].Alignment.Score = cov
-    apr := ais.APr{Type: "APr", ID: nowID(), UIA: req.UIA.ID, APA: apa.ID, Method: "semantic-entailment-v1", Evidence: ais.APrEvidence{Coverage: cov, Risk: risk}, Proof: map[string]any{}}
+    apa, err := planner.Plan(req.UIA, tools.TCAs())
+    var pe *ais.PlanError
+    if errors.As(err, &pe) { writeJSONError(w, 422, err.Error(), pe.Reason, nil); return }
+    if err != nil { writeJSONError(w, 503, "SYS-RETRY", "planner: "+err.Error(), nil); return }
+    apr := proveAlignment(req.UIA, &apa)
     // Sign APA/APr (demo symmetric key)
     if j, err := ais.SignJWSObject(secret, apa); err == nil { if apa.Proof == nil { apa.Proof = map[string]any{} }; apa.Proof["jws"] = j }
     if j, err := ais.SignJWSObject(secret, apr); err == nil { if apr.Proof == nil { apr.Proof = map[string]any{} }; apr.Proof["jws"] = j }
@@ -783,6 +1235,62 @@ func handlePlan(w http.ResponseWriter, r *http.Request) {
     _ = json.NewEncoder(w).Encode(map[string]any{"uia": req.UIA, "apa": apa, "apr": apr})
 }
 
+// handleAgentRun executes a multi-step plan for one UIA and streams its
+// progress as server-sent events (one PlanEvent per "data:" line). The APA
+// gets a single APr; each step is guarded with its own IBE and the run stops
+// at the first denial. Steps may use ${steps.<id>.output} in their args.
+func handleAgentRun(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost { writeJSONError(w, 405, "INPUT-METHOD-NOT-ALLOWED", "post only", nil); return }
+    ctx, span := otel.Tracer("aisdemo").Start(r.Context(), "api.agent.run")
+    defer span.End()
+    var req struct{ UIA ais.UIA `json:"uia"`; APA ais.APA `json:"apa"` }
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.APA.Steps) == 0 {
+        writeJSONError(w, 400, "INPUT-BAD-JSON", "uia and apa with steps required", nil)
+        return
+    }
+    apa, err := agentPlan(req.UIA, req.APA)
+    if err != nil { writeJSONError(w, 400, "INPUT-SCHEMA-INVALID", err.Error(), map[string]any{"tools": tools.Tools()}); return }
+    if err := ais.ValidatePlan(apa); err != nil {
+        var pe *ais.PlanError
+        if errors.As(err, &pe) { writeJSONError(w, 400, err.Error(), pe.Reason, map[string]any{"step": pe.Step}); return }
+        writeJSONError(w, 400, err.Error(), "step references an output that is not available", nil)
+        return
+    }
+    apr := proveAlignment(req.UIA, &apa)
+    if j, err := ais.SignJWSObject(secret, apa); err == nil { apa.Proof = map[string]any{"jws": j} }
+    if j, err := ais.SignJWSObject(secret, apr); err == nil { apr.Proof = map[string]any{"jws": j} }
+
+    w.Header().Set("content-type", "text/event-stream")
+    w.Header().Set("cache-control", "no-cache")
+    flusher, _ := w.(http.Flusher)
+    _, _ = planExecutor().Run(ctx, req.UIA, apa, apr, func(ev ais.PlanEvent) {
+        b, _ := json.Marshal(ev)
+        _, _ = io.WriteString(w, "data: "+string(b)+"\n\n")
+        if flusher != nil { flusher.Flush() }
+    })
+}
+
+// agentPlan completes a client-supplied APA for uia: step ids default to
+// s1, s2, ..., expected writes are what the tool's TCA declares, and the
+// totals are summed from the steps, so they hold whichever branches run.
+func agentPlan(uia ais.UIA, in ais.APA) (ais.APA, error) {
+    apa := ais.APA{Type: "APA", ID: in.ID, UIA: uia.ID, Model: in.Model, Proof: map[string]any{}}
+    if apa.ID == "" { apa.ID = nowID() }
+    if apa.Model.Hash == "" { apa.Model.Hash = "ollama-local" }
+    for i, s := range in.Steps {
+        tool, ok := tools.Lookup(s.Tool)
+        if !ok { return ais.APA{}, fmt.Errorf("unknown tool %q", s.Tool) }
+        if s.ID == "" { s.ID = fmt.Sprintf("s%d", i+1) }
+        if s.Expected.DataClasses == nil { s.Expected.DataClasses = []string{"derived"} }
+        for _, op := range tool.TCA().Operations { if op.Name == tool.Name() { s.Expected.Writes = op.Effects.Writes } }
+        apa.Steps = append(apa.Steps, s)
+        apa.Totals.PredictedWrites += s.Expected.Writes
+        apa.Totals.PredictedRecords++
+        if ais.ExternalCall(s.Tool) { apa.Totals.PredictedExternalCalls++ }
+    }
+    return apa, nil
+}
+
 // handleCrossCheck recomputes an alternative APA and compares deltas
 func handleCrossCheck(w http.ResponseWriter, r *http.Request) {
     var req struct{ UIA ais.UIA `json:"uia"`; APA ais.APA `json:"apa"` }
@@ -805,7 +1313,7 @@ func handleCrossCheck(w http.ResponseWriter, r *http.Request) {
 
 
 func handleModelStatus(w http.ResponseWriter, r *http.Request) {
-    c := &ais.OllamaClient{BaseURL: envDefault("OLLAMA_URL", "http://localhost:11434"), Model: envDefault("OLLAMA_MODEL", "llama3"), HTTP: http.DefaultClient}
+    c := ollamaClient()
     ok, err := c.HasModel()
     type resp struct{ Present bool `json:"present"`; Model string `json:"model"`; Error string `json:"error,omitempty"` }
     out := resp{Present: ok, Model: c.Model}
@@ -818,7 +1326,7 @@ func handleModelPull(w http.ResponseWriter, r *http.Request) {
     w.Header().Set("content-type", "application/x-ndjson")
     w.Header().Set("cache-control", "no-cache")
     flusher, _ := w.(http.Flusher)
-    c := &ais.OllamaClient{BaseURL: envDefault("OLLAMA_URL", "http://localhost:11434"), Model: envDefault("OLLAMA_MODEL", "llama3"), HTTP: http.DefaultClient}
+    c := ollamaClient()
     err := c.PullStream(func(m map[string]any) error {
         b, _ := json.Marshal(m)
         _, _ = w.Write(append(b, '\n'))
@@ -832,7 +1340,7 @@ func handleModelPull(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleModelList(w http.ResponseWriter, r *http.Request) {
-    c := &ais.OllamaClient{BaseURL: envDefault("OLLAMA_URL", "http://localhost:11434"), Model: envDefault("OLLAMA_MODEL", "llama3"), HTTP: http.DefaultClient}
+    c := ollamaClient()
     models, err := c.ListModels()
     if err != nil {
         writeJSONError(w, 500, "SYS-RETRY", err.Error(), nil)
@@ -882,6 +1390,8 @@ func writeAudit(ev map[string]any) {
     // append to file
     f, err := os.OpenFile(auditPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
     if err == nil { _, _ = f.Write(append(b, '\n')); _ = f.Close() }
+    // push notable events (guard.deny, approval.*, uia.revoked, ...) to webhooks
+    if e, _ := ev["event"].(string); e != "" && webhooks != nil { webhooks.Dispatch(e, ev) }
 }
 
 func hashText(s string) string {
@@ -890,8 +1400,10 @@ func hashText(s string) string {
 }
 
 // initTracer sets up a stdout tracer for demo purposes
-func initTracer() (*sdktrace.TracerProvider, error) {
-    exp, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+func initTracer(toStderr bool) (*sdktrace.TracerProvider, error) {
+    opts := []stdouttrace.Option{stdouttrace.WithPrettyPrint()}
+    if toStderr { opts = append(opts, stdouttrace.WithWriter(os.Stderr)) }
+    exp, err := stdouttrace.New(opts...)
     if err != nil { return nil, err }
     tp := sdktrace.NewTracerProvider(
         sdktrace.WithBatcher(exp),
@@ -902,12 +1414,11 @@ func initTracer() (*sdktrace.TracerProvider, error) {
 }
 func handleConsentMint(w http.ResponseWriter, r *http.Request) {
     if r.Method != http.MethodPost { writeJSONError(w, 405, "INPUT-METHOD-NOT-ALLOWED", "post only", nil); return }
-    var p struct{ UIA string `json:"uia"`; Step string `json:"step"`; Minutes int `json:"minutes"` }
-    if err := json.NewDecoder(r.Body).Decode(&p); err != nil || p.UIA=="" || p.Step=="" { writeJSONError(w, 400, "INPUT-BAD-JSON", "bad request", nil); return }
-    tok := ais.ConsentToken{UIARef: p.UIA, StepRef: p.Step, Exp: time.Now().Add(5*time.Minute)}
+    var p struct{ UIA string `json:"uia"`; APA string `json:"apa"`; Step string `json:"step"`; Args map[string]any `json:"args"`; Minutes int `json:"minutes"` }
+    if err := json.NewDecoder(r.Body).Decode(&p); err != nil || p.UIA=="" || p.APA=="" || p.Step=="" { writeJSONError(w, 400, "INPUT-BAD-JSON", "bad request", nil); return }
+    tok := ais.ConsentToken{UIARef: p.UIA, APARef: p.APA, StepRef: p.Step, ArgsHash: ais.ConsentArgsHash(p.Args), Exp: time.Now().Add(5*time.Minute)}
     if p.Minutes > 0 { tok.Exp = time.Now().Add(time.Duration(p.Minutes) * time.Minute) }
-    t := tok; t.Sig = ""
-    if sig, err := ais.SignJWSObject(secret, t); err == nil { tok.Sig = sig }
+    if signed, err := ais.SignConsent(secret, nil, tok); err == nil { tok = signed }
     w.Header().Set("content-type", "application/json")
     _ = json.NewEncoder(w).Encode(tok)
 }
@@ -0,0 +1,10 @@
+//go:build sqlite
+
+package main
+
+// The pure-Go SQLite driver backs sql.query. It is opt-in so the default
+// build needs no module beyond otel: `go get modernc.org/sqlite` then
+// `go build -tags sqlite ./cmd/aisdemo`.
+import _ "modernc.org/sqlite"
+
+func init() { sqlDriver = "sqlite" }
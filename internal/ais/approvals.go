@@ -0,0 +1,226 @@
+package ais
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+)
+
+// Approval is a queued elevated step awaiting a human decision.
+type Approval struct {
+    ID        string         `json:"id"`
+    Status    string         `json:"status"` // pending|approved|denied|expired
+    StepRef   string         `json:"stepRef"`
+    Tool      string         `json:"tool"`
+    Args      map[string]any `json:"args"`
+    UIA       UIA            `json:"uia"`
+    APA       APA            `json:"apa"`
+    APr       APr            `json:"apr"`
+    Reason    string         `json:"reason,omitempty"`
+    DecidedBy string         `json:"decidedBy,omitempty"`
+    CreatedAt time.Time      `json:"createdAt"`
+    ExpiresAt time.Time      `json:"expiresAt"`
+    DecidedAt *time.Time     `json:"decidedAt,omitempty"`
+    Token     *ConsentToken  `json:"token,omitempty"`
+}
+
+// Approval decision errors.
+var (
+    ErrApprovalNotFound   = errors.New("APPROVAL-NOT-FOUND")
+    ErrApprovalNotPending = errors.New("APPROVAL-NOT-PENDING")
+)
+
+// Approvals queues steps that drew a needConsent challenge until an approver
+// decides them, and keeps the co-signed consent tokens of approved steps for
+// GuardConfig.Consent. Its HTTP handler lists and decides approvals; every
+// request must carry the approver role.
+type Approvals struct {
+    Secret         []byte
+    ApproverSecret []byte
+    // TTL is how long a pending approval waits; ConsentTTL how long a minted
+    // token is valid unless the approver asks for fewer minutes.
+    TTL        time.Duration
+    ConsentTTL time.Duration
+    // Authorize reports the caller's name if the request holds one of roles.
+    Authorize func(r *http.Request, roles ...string) (string, bool)
+    // Audit receives approval events; nil drops them.
+    Audit func(map[string]any)
+
+    mu sync.Mutex
+    m  map[string]*Approval
+}
+
+// Queue records a pending approval for step, reusing an existing pending
+// entry for the same step of the same plan.
+func (q *Approvals) Queue(uia UIA, apa APA, apr APr, step APAStep) Approval {
+    now := time.Now()
+    q.mu.Lock()
+    defer q.mu.Unlock()
+    q.expireLocked(now)
+    for _, a := range q.m {
+        if a.Status == "pending" && a.UIA.ID == uia.ID && a.APA.ID == apa.ID && a.StepRef == step.ID { return *a }
+    }
+    ttl := q.TTL
+    if ttl <= 0 { ttl = 15 * time.Minute }
+    b := make([]byte, 8)
+    _, _ = rand.Read(b)
+    a := &Approval{ID: "urn:approval:" + hex.EncodeToString(b), Status: "pending", StepRef: step.ID, Tool: step.Tool, Args: step.Args, UIA: uia, APA: apa, APr: apr, CreatedAt: now, ExpiresAt: now.Add(ttl)}
+    if q.m == nil { q.m = map[string]*Approval{} }
+    q.m[a.ID] = a
+    q.audit(map[string]any{"ts": now.UTC().Format(time.RFC3339), "event": "approval.pending", "approval": a.ID, "uia": uia.ID, "apa": apa.ID, "apr": apr.ID, "step": step.ID, "tool": step.Tool})
+    return *a
+}
+
+// Challenge queues a challenged step and returns the details a client needs
+// to follow it. It fits Executor.Challenge and mcp.GuardedTools.Challenge.
+func (q *Approvals) Challenge(uia UIA, apa APA, apr APr, step APAStep) map[string]any {
+    a := q.Queue(uia, apa, apr, step)
+    return map[string]any{"approval": a.ID, "expires": a.ExpiresAt}
+}
+
+// Await polls the approval named in challenge details until it is decided,
+// expires or ctx ends, and reports whether it was approved. It fits
+// Executor.AwaitConsent.
+func (q *Approvals) Await(ctx context.Context, details map[string]any) bool {
+    id, _ := details["approval"].(string)
+    t := time.NewTicker(500 * time.Millisecond)
+    defer t.Stop()
+    for {
+        status := ""
+        if a, ok := q.Get(id); ok { status = a.Status }
+        if status != "pending" { return status == "approved" }
+        select {
+        case <-ctx.Done():
+            return false
+        case <-t.C:
+        }
+    }
+}
+
+// Get returns a copy of the approval with the given id.
+func (q *Approvals) Get(id string) (Approval, bool) {
+    q.mu.Lock()
+    defer q.mu.Unlock()
+    q.expireLocked(time.Now())
+    a, ok := q.m[id]
+    if !ok { return Approval{}, false }
+    return *a, true
+}
+
+// Consent returns the token minted by an approved approval for the given step
+// of a plan while it is valid. It fits GuardConfig.Consent.
+func (q *Approvals) Consent(uiaRef, apaRef, stepRef string) (ConsentToken, bool) {
+    now := time.Now()
+    q.mu.Lock()
+    defer q.mu.Unlock()
+    for _, a := range q.m {
+        if a.Status != "approved" || a.Token == nil { continue }
+        if a.UIA.ID == uiaRef && a.APA.ID == apaRef && a.StepRef == stepRef && now.Before(a.Token.Exp) { return *a.Token, true }
+    }
+    return ConsentToken{}, false
+}
+
+// Decide approves or denies a pending approval on behalf of who. An approval
+// mints a consent token valid for minutes, or ConsentTTL when minutes is 0.
+// It fails with ErrApprovalNotFound, or ErrApprovalNotPending along with the
+// approval as it stands.
+func (q *Approvals) Decide(id string, approve bool, who, reason string, minutes int) (Approval, error) {
+    now := time.Now()
+    q.mu.Lock()
+    defer q.mu.Unlock()
+    q.expireLocked(now)
+    a, ok := q.m[id]
+    if !ok { return Approval{}, ErrApprovalNotFound }
+    if a.Status != "pending" { return *a, ErrApprovalNotPending }
+    a.Reason, a.DecidedBy, a.DecidedAt = reason, who, &now
+    if approve {
+        ttl := q.ConsentTTL
+        if ttl <= 0 { ttl = 10 * time.Minute }
+        if minutes > 0 { ttl = time.Duration(minutes) * time.Minute }
+        tok, err := SignConsent(q.Secret, q.ApproverSecret, ConsentToken{UIARef: a.UIA.ID, APARef: a.APA.ID, StepRef: a.StepRef, ArgsHash: ConsentArgsHash(a.Args), Approver: who, Exp: now.Add(ttl)})
+        if err != nil { return Approval{}, err }
+        a.Status, a.Token = "approved", &tok
+    } else {
+        a.Status = "denied"
+    }
+    q.audit(map[string]any{"ts": now.UTC().Format(time.RFC3339), "event": "approval." + a.Status, "approval": a.ID, "uia": a.UIA.ID, "apa": a.APA.ID, "step": a.StepRef, "tool": a.Tool, "by": who, "reason": a.Reason})
+    return *a, nil
+}
+
+// expireLocked moves pending approvals past their deadline to expired.
+// Callers must hold q.mu.
+func (q *Approvals) expireLocked(now time.Time) {
+    for _, a := range q.m {
+        if a.Status != "pending" || now.Before(a.ExpiresAt) { continue }
+        a.Status = "expired"
+        q.audit(map[string]any{"ts": now.UTC().Format(time.RFC3339), "event": "approval.expired", "approval": a.ID, "uia": a.UIA.ID, "step": a.StepRef})
+    }
+}
+
+func (q *Approvals) audit(ev map[string]any) {
+    if q.Audit != nil { q.Audit(ev) }
+}
+
+// ServeHTTP serves, relative to where the handler is mounted (use
+// http.StripPrefix): GET ?status= lists approvals (pending unless another
+// status or "all" is given), GET /{id} returns one and POST /{id}/approve|deny
+// decides it. All of them require the approver role; errors are JSON
+// { Code, Message, Details }.
+func (q *Approvals) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    who, ok := "", false
+    if q.Authorize != nil { who, ok = q.Authorize(r, "approver") }
+    if !ok { writeApprovalError(w, 401, "AUTHZ-ROLE-REQUIRED", "approver role required", nil); return }
+    id, action, _ := strings.Cut(strings.Trim(r.URL.Path, "/"), "/")
+    switch {
+    case id == "":
+        if r.Method != http.MethodGet { writeApprovalError(w, 405, "INPUT-METHOD-NOT-ALLOWED", "get only", nil); return }
+        status := r.URL.Query().Get("status")
+        if status == "" { status = "pending" }
+        q.mu.Lock()
+        q.expireLocked(time.Now())
+        out := []Approval{}
+        for _, a := range q.m {
+            if status == "all" || a.Status == status { out = append(out, *a) }
+        }
+        q.mu.Unlock()
+        sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+        writeApprovalJSON(w, map[string]any{"approvals": out})
+    case action == "":
+        if r.Method != http.MethodGet { writeApprovalError(w, 405, "INPUT-METHOD-NOT-ALLOWED", "get only", nil); return }
+        a, ok := q.Get(id)
+        if !ok { writeApprovalError(w, 404, "INPUT-NOT-FOUND", "approval not found", nil); return }
+        writeApprovalJSON(w, a)
+    case action == "approve" || action == "deny":
+        if r.Method != http.MethodPost { writeApprovalError(w, 405, "INPUT-METHOD-NOT-ALLOWED", "post only", nil); return }
+        var p struct{ Reason string `json:"reason"`; Minutes int `json:"minutes"` }
+        if err := json.NewDecoder(r.Body).Decode(&p); err != nil || strings.TrimSpace(p.Reason) == "" {
+            writeApprovalError(w, 400, "INPUT-BAD-JSON", "reason required", nil)
+            return
+        }
+        a, err := q.Decide(id, action == "approve", who, p.Reason, p.Minutes)
+        if errors.Is(err, ErrApprovalNotFound) { writeApprovalError(w, 404, "INPUT-NOT-FOUND", "approval not found", nil); return }
+        if errors.Is(err, ErrApprovalNotPending) { writeApprovalError(w, 409, "APPROVAL-NOT-PENDING", "approval is "+a.Status, map[string]any{"approval": a.ID}); return }
+        if err != nil { writeApprovalError(w, 500, "SYS-RETRY", err.Error(), nil); return }
+        writeApprovalJSON(w, a)
+    default:
+        writeApprovalError(w, 404, "INPUT-NOT-FOUND", "unknown action", nil)
+    }
+}
+
+func writeApprovalJSON(w http.ResponseWriter, v any) {
+    w.Header().Set("content-type", "application/json")
+    _ = json.NewEncoder(w).Encode(v)
+}
+
+func writeApprovalError(w http.ResponseWriter, status int, code, msg string, details map[string]any) {
+    w.Header().Set("content-type", "application/json")
+    w.WriteHeader(status)
+    _ = json.NewEncoder(w).Encode(struct{ Code, Message string; Details map[string]any }{code, msg, details})
+}
@@ -0,0 +1,145 @@
+package ais
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "sort"
+    "sync"
+)
+
+// DefaultCalibrationFloor is the lowest calibrated threshold a profile
+// without a floor of its own accepts.
+const DefaultCalibrationFloor = 0.5
+
+// profileFloors is the lowest calibrated threshold each policy profile
+// accepts; profiles without an entry fall back to "default".
+var profileFloors = struct{ sync.RWMutex; m map[string]float64 }{m: map[string]float64{"default": DefaultCalibrationFloor}}
+
+// SetProfileFloor sets the lowest calibrated threshold a policy profile accepts.
+func SetProfileFloor(profile string, floor float64) {
+    profileFloors.Lock()
+    profileFloors.m[profile] = floor
+    profileFloors.Unlock()
+}
+
+// ProfileFloor returns the lowest calibrated threshold the policy profile accepts.
+func ProfileFloor(profile string) float64 {
+    profileFloors.RLock()
+    defer profileFloors.RUnlock()
+    if f, ok := profileFloors.m[profile]; ok { return f }
+    return profileFloors.m["default"]
+}
+
+// CalibrationCase is one labelled example: does the APA serve the UIA?
+type CalibrationCase struct {
+    ID      string `json:"id"`
+    UIA     UIA    `json:"uia"`
+    APA     APA    `json:"apa"`
+    Aligned bool   `json:"aligned"`
+}
+
+// ROCPoint is the confusion matrix of one candidate threshold.
+type ROCPoint struct {
+    Threshold float64 `json:"threshold"`
+    TP        int     `json:"tp"`
+    FP        int     `json:"fp"`
+    TN        int     `json:"tn"`
+    FN        int     `json:"fn"`
+    Precision float64 `json:"precision"`
+    Recall    float64 `json:"recall"`
+    FPR       float64 `json:"fpr"`
+    F1        float64 `json:"f1"`
+}
+
+// CalibratedThreshold is the chosen threshold for one profile and method with
+// the metrics it achieved on the dataset.
+type CalibratedThreshold struct {
+    Threshold float64 `json:"threshold"`
+    Precision float64 `json:"precision"`
+    Recall    float64 `json:"recall"`
+    F1        float64 `json:"f1"`
+    AUC       float64 `json:"auc"`
+    Cases     int     `json:"cases"`
+}
+
+// Calibration maps policy profile -> APr method -> threshold. The guard uses
+// it in place of GuardConfig.MinAlignment when an entry exists.
+type Calibration struct {
+    Dataset  string                                    `json:"dataset,omitempty"`
+    Profiles map[string]map[string]CalibratedThreshold `json:"profiles"`
+}
+
+// LoadCalibration reads a calibration file written by aiscalibrate.
+func LoadCalibration(path string) (*Calibration, error) {
+    b, err := os.ReadFile(path)
+    if err != nil { return nil, err }
+    var c Calibration
+    if err := json.Unmarshal(b, &c); err != nil { return nil, fmt.Errorf("%s: %w", path, err) }
+    return &c, nil
+}
+
+// Threshold returns the calibrated threshold for profile and method, then for
+// the "default" profile, then fallback. A calibrated threshold is raised to
+// the profile's floor, so a degenerate dataset cannot switch alignment off.
+func (c *Calibration) Threshold(profile, method string, fallback float64) float64 {
+    if c == nil { return fallback }
+    for _, p := range []string{profile, "default"} {
+        if t, ok := c.Profiles[p][method]; ok { return max(t.Threshold, ProfileFloor(profile)) }
+    }
+    return fallback
+}
+
+// ROC computes one point per distinct score (predict aligned when score >=
+// threshold), ordered by descending threshold, and the area under the curve.
+func ROC(scores []float64, labels []bool) ([]ROCPoint, float64) {
+    ts := append([]float64(nil), scores...)
+    sort.Sort(sort.Reverse(sort.Float64Slice(ts)))
+    var pts []ROCPoint
+    for i, t := range ts {
+        if i > 0 && ts[i-1] == t { continue }
+        p := ROCPoint{Threshold: t}
+        for j, s := range scores {
+            switch {
+            case s >= t && labels[j]:
+                p.TP++
+            case s >= t:
+                p.FP++
+            case labels[j]:
+                p.FN++
+            default:
+                p.TN++
+            }
+        }
+        if p.TP+p.FP > 0 { p.Precision = float64(p.TP) / float64(p.TP+p.FP) }
+        if p.TP+p.FN > 0 { p.Recall = float64(p.TP) / float64(p.TP+p.FN) }
+        if p.FP+p.TN > 0 { p.FPR = float64(p.FP) / float64(p.FP+p.TN) }
+        if p.Precision+p.Recall > 0 { p.F1 = 2 * p.Precision * p.Recall / (p.Precision + p.Recall) }
+        pts = append(pts, p)
+    }
+    // trapezoids from (0,0) through every point; the lowest threshold reaches (1,1)
+    auc, x, y := 0.0, 0.0, 0.0
+    for _, p := range pts {
+        auc += (p.FPR - x) * (p.Recall + y) / 2
+        x, y = p.FPR, p.Recall
+    }
+    return pts, auc
+}
+
+// BestThreshold picks the point with the highest recall among those reaching
+// minPrecision, or the highest F1 if none does (or minPrecision is 0). Ties go
+// to the higher threshold.
+func BestThreshold(pts []ROCPoint, minPrecision float64) ROCPoint {
+    var best ROCPoint
+    found := false
+    if minPrecision > 0 {
+        for _, p := range pts {
+            if p.Precision >= minPrecision && (!found || p.Recall > best.Recall) { best, found = p, true }
+        }
+    }
+    if found { return best }
+    for _, p := range pts {
+        if !found || p.F1 > best.F1 { best, found = p, true }
+    }
+    return best
+}
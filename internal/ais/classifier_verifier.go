@@ -1,6 +1,27 @@
 package ais
 
-import "strings"
+import (
+    "fmt"
+    "strings"
+)
+
+// ClassifierVerifier registers VerifyAlignmentClassifier as classifier-v1.
+type ClassifierVerifier struct{}
+
+func (ClassifierVerifier) Method() string { return "classifier-v1" }
+
+func (ClassifierVerifier) Verify(uia UIA, apa APA) APrEvidence {
+    cov, risk := VerifyAlignmentClassifier(uia, apa)
+    terms := extractKeywords(strings.ToLower(uia.Purpose))
+    steps := make([]StepEvidence, 0, len(apa.Steps))
+    for _, s := range apa.Steps {
+        m := matchedTerms(stepText(s), terms)
+        se := StepEvidence{Step: s.ID, Matched: m, Reason: fmt.Sprintf("%d/%d purpose terms", len(m), len(terms))}
+        if len(terms) == 0 || len(m)*2 >= len(terms) { se.Score = 1 }
+        steps = append(steps, se)
+    }
+    return APrEvidence{Coverage: cov, Risk: risk, Steps: steps, Obligations: DeriveObligations(uia, apa)}
+}
 
 // VerifyAlignmentClassifier is a simple deterministic classifier-like scorer
 // based on keyword frequency overlap between purpose and step prompts/urls.
@@ -0,0 +1,55 @@
+package ais
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "time"
+)
+
+// ConsentArgsHash is the ArgsHash of a consent token for a step with args:
+// sha256 over their canonical JSON. For steps with ${steps...} references
+// it covers the references as planned.
+func ConsentArgsHash(args map[string]any) string {
+    b, _ := marshalCanonical(args)
+    sum := sha256.Sum256(b)
+    return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// SignConsent signs a consent token with the server secret and, when an
+// approver secret is given, adds the approver co-signature. Both signatures
+// cover the token with Sig and CoSig blanked.
+func SignConsent(secret, approverSecret []byte, tok ConsentToken) (ConsentToken, error) {
+    t := tok
+    t.Sig, t.CoSig = "", ""
+    sig, err := SignJWSObject(secret, t)
+    if err != nil { return tok, err }
+    tok.Sig = sig
+    if len(approverSecret) > 0 {
+        co, err := SignJWSObject(approverSecret, t)
+        if err != nil { return tok, err }
+        tok.CoSig = co
+    }
+    return tok, nil
+}
+
+// VerifyConsent checks expiry, the server signature and, when an approver
+// secret is configured, the approver co-signature.
+func VerifyConsent(secret, approverSecret []byte, tok ConsentToken, now time.Time) error {
+    if now.After(tok.Exp) { return errors.New("CONSENT-EXPIRED") }
+    t := tok
+    t.Sig, t.CoSig = "", ""
+    if ok, _ := VerifyJWSObject(secret, t, tok.Sig); !ok { return errors.New("CONSENT-SIG-INVALID") }
+    if len(approverSecret) > 0 {
+        if ok, _ := VerifyJWSObject(approverSecret, t, tok.CoSig); !ok { return errors.New("CONSENT-COSIG-INVALID") }
+    }
+    return nil
+}
+
+// stepElevated reports whether a step needs stepwise consent: it writes, its
+// operation declares writes, or its tool is listed as elevated.
+func stepElevated(cfg GuardConfig, step APAStep, op TCAOperation) bool {
+    if step.Expected.Writes > 0 || op.Effects.Writes > 0 { return true }
+    for _, t := range cfg.ElevatedTools { if t == step.Tool { return true } }
+    return false
+}
@@ -0,0 +1,190 @@
+package ais
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "regexp"
+    "slices"
+    "sort"
+    "strings"
+)
+
+// DLP detector checks, run on each regex match to weed out look-alikes.
+const (
+    DLPCheckLuhn  = "luhn"   // card numbers: 13-19 digits passing the Luhn checksum
+    DLPCheckUSSSN = "us-ssn" // no 000/666/9xx area, 00 group or 0000 serial
+)
+
+// DLP actions for detected classes the UIA does not permit.
+const (
+    DLPBlock  = "block"
+    DLPRedact = "redact"
+)
+
+// DLPDetector labels matches of Pattern with the data class Class.
+type DLPDetector struct {
+    ID      string `json:"id"`
+    Class   string `json:"class"`
+    Pattern string `json:"pattern"`
+    Check   string `json:"check,omitempty"`
+
+    re *regexp.Regexp
+}
+
+// DLPFinding is one detected span of a result.
+type DLPFinding struct {
+    Detector   string
+    Class      string
+    Start, End int
+}
+
+// DLPReport summarizes a classified result for the audit log: the classes
+// found, how often each was found, and how many spans were redacted.
+type DLPReport struct {
+    Labels   []string       `json:"labels,omitempty"`
+    Counts   map[string]int `json:"counts,omitempty"`
+    Denied   []string       `json:"denied,omitempty"`
+    Redacted int            `json:"redacted,omitempty"`
+}
+
+// DLPError is DATA-CLASS-NOT-PERMITTED raised on a tool result: it carries
+// classes the UIA does not permit and the scanner's action is block.
+type DLPError struct{ Report DLPReport }
+
+func (e *DLPError) Error() string { return "DATA-CLASS-NOT-PERMITTED" }
+
+// DLPScanner classifies tool results. Detectors run in order and an earlier
+// detector's match wins over an overlapping later one, so card numbers are
+// not also counted as phone numbers. Classes outside the UIA's dataClasses
+// are blocked or, with Action redact, replaced by "[redacted-<detector>]".
+type DLPScanner struct {
+    Detectors []DLPDetector `json:"detectors"`
+    Action    string        `json:"action"`
+}
+
+// DefaultDLPScanner returns the built-in detectors (emails, phone numbers and
+// national IDs as pii, Luhn-valid card numbers as pci, API keys as secret),
+// redacting what the UIA does not permit.
+func DefaultDLPScanner() *DLPScanner {
+    s := &DLPScanner{Action: DLPRedact, Detectors: []DLPDetector{
+        {ID: "api-key", Class: "secret", Pattern: `\b(?:AKIA[0-9A-Z]{16}|gh[pousr]_[A-Za-z0-9]{36}|github_pat_[A-Za-z0-9_]{40,}|xox[abprs]-[A-Za-z0-9-]{10,}|[sr]k_(?:live|test)_[A-Za-z0-9]{16,}|sk-[A-Za-z0-9_-]{20,}|AIza[0-9A-Za-z_-]{35}|glpat-[A-Za-z0-9_-]{20})\b`},
+        {ID: "credit-card", Class: "pci", Pattern: `\b\d(?:[ -]?\d){12,18}\b`, Check: DLPCheckLuhn},
+        {ID: "email", Class: "pii", Pattern: `[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`},
+        {ID: "us-ssn", Class: "pii", Pattern: `\b\d{3}-\d{2}-\d{4}\b`, Check: DLPCheckUSSSN},
+        {ID: "uk-nino", Class: "pii", Pattern: `\b[A-CEGHJ-PR-TW-Z][A-CEGHJ-NPR-TW-Z] ?\d{2} ?\d{2} ?\d{2} ?[A-D]\b`},
+        {ID: "phone", Class: "pii", Pattern: `(?:\+\d{1,3}[ .\-]?)?(?:\(\d{2,4}\)|\b\d{2,4})[ .\-]\d{3,4}[ .\-]\d{3,4}\b`},
+    }}
+    if err := s.Compile(); err != nil { panic(err) }
+    return s
+}
+
+// LoadDLPScanner reads a scanner config {action, detectors}.
+func LoadDLPScanner(path string) (*DLPScanner, error) {
+    b, err := os.ReadFile(path)
+    if err != nil { return nil, err }
+    s := &DLPScanner{}
+    if err := json.Unmarshal(b, s); err != nil { return nil, fmt.Errorf("%s: %w", path, err) }
+    if err := s.Compile(); err != nil { return nil, fmt.Errorf("%s: %w", path, err) }
+    return s, nil
+}
+
+// Compile validates the detectors and compiles their patterns; the action
+// defaults to block.
+func (s *DLPScanner) Compile() error {
+    switch s.Action {
+    case "":
+        s.Action = DLPBlock
+    case DLPBlock, DLPRedact:
+    default:
+        return fmt.Errorf("dlp: unknown action %q", s.Action)
+    }
+    for i := range s.Detectors {
+        d := &s.Detectors[i]
+        if d.ID == "" || d.Class == "" { return fmt.Errorf("dlp detector %d: id and class are required", i) }
+        switch d.Check {
+        case "", DLPCheckLuhn, DLPCheckUSSSN:
+        default:
+            return fmt.Errorf("dlp detector %s: unknown check %q", d.ID, d.Check)
+        }
+        re, err := regexp.Compile(d.Pattern)
+        if err != nil { return fmt.Errorf("dlp detector %s: %w", d.ID, err) }
+        d.re = re
+    }
+    return nil
+}
+
+// Scan returns the non-overlapping findings in text, in text order.
+func (s *DLPScanner) Scan(text string) []DLPFinding {
+    var out []DLPFinding
+    for _, d := range s.Detectors {
+        for _, m := range d.re.FindAllStringIndex(text, -1) {
+            if !dlpCheck(d.Check, text[m[0]:m[1]]) { continue }
+            if slices.ContainsFunc(out, func(f DLPFinding) bool { return m[0] < f.End && f.Start < m[1] }) { continue }
+            out = append(out, DLPFinding{Detector: d.ID, Class: d.Class, Start: m[0], End: m[1]})
+        }
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].Start < out[j].Start })
+    return out
+}
+
+// Enforce classifies out against the UIA's data classes. Permitted classes
+// pass; others fail with a DLPError, or are redacted when Action is redact.
+func (s *DLPScanner) Enforce(uia UIA, out string) (string, DLPReport, error) {
+    findings := s.Scan(out)
+    rep := DLPReport{}
+    if len(findings) == 0 { return out, rep, nil }
+    rep.Counts = map[string]int{}
+    var b strings.Builder
+    last := 0
+    for _, f := range findings {
+        rep.Counts[f.Class]++
+        if slices.Contains(uia.Constraints.DataClasses, f.Class) { continue }
+        if !slices.Contains(rep.Denied, f.Class) { rep.Denied = append(rep.Denied, f.Class) }
+        b.WriteString(out[last:f.Start])
+        b.WriteString("[redacted-" + f.Detector + "]")
+        last = f.End
+        rep.Redacted++
+    }
+    for c := range rep.Counts { rep.Labels = append(rep.Labels, c) }
+    sort.Strings(rep.Labels)
+    sort.Strings(rep.Denied)
+    if len(rep.Denied) == 0 { return out, rep, nil }
+    if s.Action != DLPRedact { rep.Redacted = 0; return "", rep, &DLPError{Report: rep} }
+    b.WriteString(out[last:])
+    return b.String(), rep, nil
+}
+
+func dlpCheck(check, match string) bool {
+    switch check {
+    case DLPCheckLuhn:
+        return luhnValid(match)
+    case DLPCheckUSSSN:
+        area, group, serial := match[0:3], match[4:6], match[7:11]
+        return area != "000" && area != "666" && area[0] != '9' && group != "00" && serial != "0000"
+    }
+    return true
+}
+
+// luhnValid checks the digits of s (separators ignored) against the Luhn
+// checksum; 13-19 digits, not all the same.
+func luhnValid(s string) bool {
+    var digits []int
+    for _, r := range s {
+        if r >= '0' && r <= '9' { digits = append(digits, int(r-'0')) }
+    }
+    if len(digits) < 13 || len(digits) > 19 { return false }
+    same := true
+    for _, d := range digits[1:] { if d != digits[0] { same = false } }
+    if same { return false }
+    sum := 0
+    for i := range digits {
+        d := digits[len(digits)-1-i]
+        if i%2 == 1 {
+            d *= 2
+            if d > 9 { d -= 9 }
+        }
+        sum += d
+    }
+    return sum%10 == 0
+}
@@ -0,0 +1,86 @@
+package ais
+
+import (
+    "fmt"
+    "math"
+)
+
+// DefaultEmbeddingThreshold is used when EmbeddingVerifier.Threshold is unset.
+const DefaultEmbeddingThreshold = 0.6
+
+// EmbeddingVerifier implements embedding-cosine-v1: the UIA purpose and each
+// step's prompt or url are embedded through Ollama and a step is aligned when
+// their cosine similarity reaches Threshold. A step's score is that cosine
+// (negative ones count as 0), and through StepThreshold the guard holds it to
+// the same Threshold, so a step counted as aligned is never refused for its
+// score. Evidence pins the embedding model digest; scores are rounded to 1e-6
+// so recomputation is stable.
+type EmbeddingVerifier struct {
+    Client    *OllamaClient
+    Threshold float64
+}
+
+func (EmbeddingVerifier) Method() string { return "embedding-cosine-v1" }
+
+// StepThreshold is the cosine at which a step is aligned.
+func (v EmbeddingVerifier) StepThreshold() float64 {
+    if v.Threshold <= 0 { return DefaultEmbeddingThreshold }
+    return v.Threshold
+}
+
+func (v EmbeddingVerifier) Verify(uia UIA, apa APA) APrEvidence {
+    ev := APrEvidence{Risk: planRisk(uia, apa), Obligations: DeriveObligations(uia, apa), Model: v.Client.Model}
+    if len(apa.Steps) == 0 { ev.Risk = 1; return ev }
+    digest, err := v.Client.ModelDigest()
+    if err != nil { return embeddingFailure(ev, apa, err) }
+    ev.ModelDigest = digest
+    purpose, err := v.Client.Embed(uia.Purpose)
+    if err != nil { return embeddingFailure(ev, apa, err) }
+    th := v.StepThreshold()
+    aligned := 0
+    for _, s := range apa.Steps {
+        text := stepRawText(s)
+        se := StepEvidence{Step: s.ID, Reason: "tool not covered by method"}
+        if text != "" {
+            vec, err := v.Client.Embed(text)
+            if err != nil { return embeddingFailure(ev, apa, err) }
+            cos := round6(cosine(purpose, vec))
+            se.Score = clamp01(cos)
+            se.Reason = fmt.Sprintf("cosine %.6f vs threshold %.6f", cos, th)
+            if cos >= th { aligned++ }
+        }
+        ev.Steps = append(ev.Steps, se)
+    }
+    ev.Coverage = float64(aligned) / float64(len(apa.Steps))
+    return ev
+}
+
+// embeddingFailure fails closed: zero coverage and full risk.
+func embeddingFailure(ev APrEvidence, apa APA, err error) APrEvidence {
+    ev.Coverage, ev.Risk, ev.Steps = 0, 1, nil
+    for _, s := range apa.Steps { ev.Steps = append(ev.Steps, StepEvidence{Step: s.ID, Reason: "embedding error: " + err.Error()}) }
+    return ev
+}
+
+// stepRawText is the prompt or url a model-backed verifier compares with the purpose.
+func stepRawText(s APAStep) string {
+    var text string
+    if s.Tool == "ollama.generate" {
+        text, _ = s.Args["prompt"].(string)
+    } else if s.Tool == "http.get" {
+        text, _ = s.Args["url"].(string)
+    }
+    return text
+}
+
+func cosine(a, b []float64) float64 {
+    if len(a) != len(b) || len(a) == 0 { return 0 }
+    var dot, na, nb float64
+    for i := range a { dot += a[i] * b[i]; na += a[i] * a[i]; nb += b[i] * b[i] }
+    if na == 0 || nb == 0 { return 0 }
+    return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
+
+func round6(f float64) float64 { return math.Round(f*1e6) / 1e6 }
+
+func clamp01(f float64) float64 { if f < 0 { return 0 }; if f > 1 { return 1 }; return f }
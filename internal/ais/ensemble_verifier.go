@@ -0,0 +1,106 @@
+package ais
+
+import (
+    "fmt"
+    "slices"
+    "sort"
+)
+
+// Ensemble combination rules.
+const (
+    EnsembleMin          = "min"
+    EnsembleWeightedMean = "weighted-mean"
+    EnsembleKOfN         = "k-of-n"
+)
+
+// ComponentEvidence is one sub-method's evidence inside an ensemble APr.
+type ComponentEvidence struct {
+    Method string  `json:"method"`
+    Weight float64 `json:"weight,omitempty"`
+    APrEvidence
+}
+
+// EnsembleVerifier implements ensemble-v1: it runs the registered verifiers
+// named in Methods and combines their evidence.
+//   - min: lowest coverage and step scores, highest risk.
+//   - weighted-mean: Weights-weighted means (missing weights count 1).
+//   - k-of-n: the K-th highest coverage and step scores, so the ensemble
+//     passes a threshold exactly when at least K components do; highest risk.
+// Obligations and policy denials are the union of all components. Unknown components fail closed.
+type EnsembleVerifier struct {
+    Methods []string
+    Rule    string
+    K       int
+    Weights map[string]float64
+}
+
+func (EnsembleVerifier) Method() string { return "ensemble-v1" }
+
+func (v EnsembleVerifier) Verify(uia UIA, apa APA) APrEvidence {
+    ev := APrEvidence{Rule: v.ruleName()}
+    if len(v.Methods) == 0 { ev.Risk = 1; return ev }
+    for _, m := range v.Methods {
+        c := ComponentEvidence{Method: m}
+        if v.Rule == EnsembleWeightedMean { c.Weight = v.weight(m) }
+        if sub, ok := LookupVerifier(m); ok && m != v.Method() {
+            c.APrEvidence = sub.Verify(uia, apa)
+        } else {
+            c.APrEvidence = APrEvidence{Risk: 1}
+            for _, s := range apa.Steps { c.Steps = append(c.Steps, StepEvidence{Step: s.ID, Reason: "unknown component method"}) }
+        }
+        ev.Components = append(ev.Components, c)
+    }
+    covs, risks := make([]float64, len(ev.Components)), make([]float64, len(ev.Components))
+    for i, c := range ev.Components {
+        covs[i], risks[i] = c.Coverage, c.Risk
+        for _, o := range c.Obligations { if !slices.Contains(ev.Obligations, o) { ev.Obligations = append(ev.Obligations, o) } }
+        for _, d := range c.Denials { if !slices.Contains(ev.Denials, d) { ev.Denials = append(ev.Denials, d) } }
+    }
+    sort.Strings(ev.Obligations)
+    sort.Strings(ev.Denials)
+    ev.Coverage, ev.Risk = v.combine(covs, false), v.combine(risks, true)
+    for _, s := range apa.Steps {
+        scores := make([]float64, len(ev.Components))
+        for i, c := range ev.Components { se, _ := stepEvidence(c.APrEvidence, s.ID); scores[i] = se.Score }
+        ev.Steps = append(ev.Steps, StepEvidence{Step: s.ID, Score: v.combine(scores, false), Reason: ev.Rule + " of components"})
+    }
+    return ev
+}
+
+// combine folds component values; risk uses the worst case except under weighted-mean.
+func (v EnsembleVerifier) combine(vals []float64, risk bool) float64 {
+    switch {
+    case v.Rule == EnsembleWeightedMean:
+        var sum, wsum float64
+        for i, x := range vals { w := v.weight(v.Methods[i]); sum += w * x; wsum += w }
+        if wsum == 0 { return 0 }
+        return round6(sum / wsum)
+    case risk:
+        return slices.Max(vals)
+    case v.Rule == EnsembleKOfN:
+        sorted := append([]float64(nil), vals...)
+        sort.Sort(sort.Reverse(sort.Float64Slice(sorted)))
+        k := v.K
+        if k < 1 { k = 1 }
+        if k > len(sorted) { return 0 }
+        return sorted[k-1]
+    default:
+        return slices.Min(vals)
+    }
+}
+
+func (v EnsembleVerifier) weight(m string) float64 {
+    if w, ok := v.Weights[m]; ok { return w }
+    return 1
+}
+
+func (v EnsembleVerifier) ruleName() string {
+    switch v.Rule {
+    case EnsembleKOfN:
+        return fmt.Sprintf("%d-of-%d", v.K, len(v.Methods))
+    case EnsembleWeightedMean:
+        return EnsembleWeightedMean
+    default:
+        return EnsembleMin
+    }
+}
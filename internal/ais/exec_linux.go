@@ -0,0 +1,60 @@
+//go:build linux
+
+package ais
+
+import (
+    "errors"
+    "os"
+    "os/exec"
+    "strconv"
+    "syscall"
+)
+
+// sandboxAttr starts the command in its own process group and, unless the
+// network is declared, in a new network namespace holding only loopback.
+// Without root that needs an unprivileged user namespace; if the kernel or
+// a seccomp profile refuses it, Start fails and nothing runs.
+func sandboxAttr(network bool) (*syscall.SysProcAttr, error) {
+    attr := &syscall.SysProcAttr{Setpgid: true, Pdeathsig: syscall.SIGKILL}
+    if network { return attr, nil }
+    attr.Cloneflags = syscall.CLONE_NEWNET
+    if os.Geteuid() != 0 {
+        attr.Cloneflags |= syscall.CLONE_NEWUSER
+        attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: os.Geteuid(), HostID: os.Geteuid(), Size: 1}}
+        attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getegid(), HostID: os.Getegid(), Size: 1}}
+    }
+    return attr, nil
+}
+
+// execLimitsScript is the wrapper exec.run starts in place of the command:
+// it sets the rlimits with the shell's ulimit (setrlimit) and then execs the
+// command, so they are in force before its first instruction. The CPU hard
+// limit is a second above the soft one so the command sees SIGXCPU before
+// SIGKILL; a memory limit of 0 leaves the address space unlimited. If a
+// limit cannot be set the command never runs and the wrapper exits 126.
+const execLimitsScript = `ulimit -c 0 && ulimit -S -t "$1" && ulimit -H -t "$2" && { [ "$3" = 0 ] || ulimit -v "$3"; } || exit 126
+shift 3
+exec "$@"`
+
+// limitedCommand returns the program and arguments that run path with argv
+// under the CPU and memory rlimits of eff and with core dumps disabled.
+func limitedCommand(path string, argv []string, eff ExecEffects) (string, []string, error) {
+    cpu := eff.CPUSeconds
+    mem := eff.MaxMemoryBytes / 1024
+    if eff.MaxMemoryBytes > 0 && mem == 0 { mem = 1 }
+    args := append([]string{"-c", execLimitsScript, "exec.run", strconv.Itoa(cpu), strconv.Itoa(cpu + 1), strconv.FormatInt(mem, 10), path}, argv...)
+    return "/bin/sh", args, nil
+}
+
+// killGroup kills the process group led by pid.
+func killGroup(pid int) error {
+    err := syscall.Kill(-pid, syscall.SIGKILL)
+    if errors.Is(err, syscall.ESRCH) { return nil }
+    return err
+}
+
+func exitError(ee *exec.ExitError, stderr string) error {
+    e := &ExecExitError{Code: ee.ExitCode(), Stderr: stderr}
+    if ws, ok := ee.Sys().(syscall.WaitStatus); ok && ws.Signaled() { e.Signal = ws.Signal().String() }
+    return e
+}
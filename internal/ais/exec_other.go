@@ -0,0 +1,25 @@
+//go:build !linux
+
+package ais
+
+import (
+    "errors"
+    "os/exec"
+    "syscall"
+)
+
+// exec.run relies on Linux process groups, namespaces and rlimits; other
+// platforms refuse to run commands rather than run them unconfined.
+func sandboxAttr(network bool) (*syscall.SysProcAttr, error) {
+    return nil, errors.New("exec.run: sandboxing requires Linux")
+}
+
+func limitedCommand(path string, argv []string, eff ExecEffects) (string, []string, error) {
+    return "", nil, errors.New("exec.run: sandboxing requires Linux")
+}
+
+func killGroup(pid int) error { return nil }
+
+func exitError(ee *exec.ExitError, stderr string) error {
+    return &ExecExitError{Code: ee.ExitCode(), Stderr: stderr}
+}
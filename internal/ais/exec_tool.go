@@ -0,0 +1,218 @@
+package ais
+
+import (
+    "bytes"
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "regexp"
+    "strings"
+    "time"
+)
+
+// exec.run defaults, applied by NewExecTool to zero limits.
+const (
+    DefaultExecTimeout    = 10 * time.Second
+    DefaultExecCPUSeconds = 5
+    DefaultExecMaxOutput  = 64 << 10
+    DefaultExecMaxArgs    = 32
+    execStderrBytes       = 2000
+)
+
+// ExecExitError reports a command that exited non-zero or was killed by a
+// signal (e.g. on reaching its CPU limit).
+type ExecExitError struct {
+    Code   int
+    Signal string
+    Stderr string
+}
+
+func (e *ExecExitError) Error() string {
+    if e.Signal != "" { return "exec.run: killed by " + e.Signal }
+    return fmt.Sprintf("exec.run: exit status %d", e.Code)
+}
+
+// ExecTool is exec.run: runs an allowlisted binary with checked arguments in
+// a fixed directory, with an allowlisted environment, in a fresh process
+// group under CPU, memory, time and output limits and, unless the effects
+// declare Network, without network access. Sandboxing needs Linux; elsewhere
+// the tool refuses to run.
+type ExecTool struct{ Effects ExecEffects }
+
+// NewExecTool resolves each command's Path (through PATH when unset),
+// requires an existing absolute working directory, compiles the argument
+// patterns and fills in default limits.
+func NewExecTool(eff ExecEffects) (*ExecTool, error) {
+    if !filepath.IsAbs(eff.Dir) { return nil, fmt.Errorf("exec.run: dir %q must be absolute", eff.Dir) }
+    if fi, err := os.Stat(eff.Dir); err != nil || !fi.IsDir() { return nil, fmt.Errorf("exec.run: dir %q is not a directory", eff.Dir) }
+    cmds := make([]ExecCommand, 0, len(eff.Commands))
+    for _, c := range eff.Commands {
+        if c.Name == "" { return nil, errors.New("exec.run: command without a name") }
+        if c.Path == "" {
+            p, err := exec.LookPath(c.Name)
+            if err != nil { return nil, fmt.Errorf("exec.run: %w", err) }
+            c.Path = p
+        }
+        if !filepath.IsAbs(c.Path) { return nil, fmt.Errorf("exec.run: %s: path %q must be absolute", c.Name, c.Path) }
+        pats, err := compileArgPatterns(c.Args)
+        if err != nil { return nil, fmt.Errorf("exec.run: %s: %w", c.Name, err) }
+        c.patterns = pats
+        if c.MaxArgs <= 0 { c.MaxArgs = DefaultExecMaxArgs }
+        cmds = append(cmds, c)
+    }
+    eff.Commands = cmds
+    if eff.TimeoutMs <= 0 { eff.TimeoutMs = int(DefaultExecTimeout / time.Millisecond) }
+    if eff.CPUSeconds <= 0 { eff.CPUSeconds = DefaultExecCPUSeconds }
+    if eff.MaxOutputBytes <= 0 { eff.MaxOutputBytes = DefaultExecMaxOutput }
+    return &ExecTool{Effects: eff}, nil
+}
+
+func (t *ExecTool) Name() string { return "exec.run" }
+
+func (t *ExecTool) TCA() TCA {
+    eff := t.Effects
+    return TCA{ID: "urn:tca:exec.run@1", Operator: "local", Operations: []TCAOperation{{Name: "exec.run", Effects: OperationEffects{Writes: 0, DataClasses: []string{"derived"}, Exec: &eff}}}}
+}
+
+// InputSchema lists the allowed commands; argument patterns stay in the TCA.
+func (t *ExecTool) InputSchema() map[string]any {
+    names := make([]string, 0, len(t.Effects.Commands))
+    for _, c := range t.Effects.Commands { names = append(names, c.Name) }
+    return map[string]any{"type": "object", "properties": map[string]any{
+        "cmd":  map[string]any{"type": "string", "enum": names},
+        "args": map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+    }, "required": []string{"cmd"}}
+}
+
+func (t *ExecTool) ValidateArgs(args map[string]any) error {
+    _, _, err := t.Effects.CheckArgs(args)
+    return err
+}
+
+// CheckArgs matches args {"cmd": name, "args": [...]} against the allowlist
+// and returns the command and its arguments. Commands set up by NewExecTool
+// use their compiled patterns; others, such as those of a TCA read from
+// JSON, are compiled here and an invalid pattern fails the check.
+func (e *ExecEffects) CheckArgs(args map[string]any) (*ExecCommand, []string, error) {
+    name, ok := args["cmd"].(string)
+    if !ok || name == "" { return nil, nil, errors.New("cmd must be a non-empty string") }
+    var cmd *ExecCommand
+    for i := range e.Commands { if e.Commands[i].Name == name { cmd = &e.Commands[i]; break } }
+    if cmd == nil { return nil, nil, fmt.Errorf("command %q is not allowed", name) }
+    var argv []string
+    switch v := args["args"].(type) {
+    case nil:
+    case []string:
+        argv = v
+    case []any:
+        for _, x := range v {
+            s, ok := x.(string)
+            if !ok { return nil, nil, errors.New("args must be strings") }
+            argv = append(argv, s)
+        }
+    default:
+        return nil, nil, errors.New("args must be a list of strings")
+    }
+    maxArgs := cmd.MaxArgs
+    if maxArgs <= 0 { maxArgs = DefaultExecMaxArgs }
+    if len(argv) > maxArgs { return nil, nil, fmt.Errorf("%s takes at most %d args", name, maxArgs) }
+    pats := cmd.patterns
+    if len(pats) != len(cmd.Args) {
+        var err error
+        if pats, err = compileArgPatterns(cmd.Args); err != nil { return nil, nil, fmt.Errorf("%s: %w", name, err) }
+    }
+    for _, a := range argv {
+        if strings.IndexByte(a, 0) >= 0 { return nil, nil, errors.New("args must not contain NUL") }
+        ok := false
+        for _, re := range pats {
+            if re.MatchString(a) { ok = true; break }
+        }
+        if !ok { return nil, nil, fmt.Errorf("%s: argument %q is not allowed", name, a) }
+    }
+    return cmd, argv, nil
+}
+
+// compileArgPatterns compiles argument patterns anchored to match a whole
+// argument.
+func compileArgPatterns(args []string) ([]*regexp.Regexp, error) {
+    pats := make([]*regexp.Regexp, 0, len(args))
+    for _, p := range args {
+        re, err := regexp.Compile(`^(?:` + p + `)$`)
+        if err != nil { return nil, fmt.Errorf("argument pattern %q: %w", p, err) }
+        pats = append(pats, re)
+    }
+    return pats, nil
+}
+
+func (t *ExecTool) Invoke(ctx context.Context, args map[string]any) (Result, error) {
+    cmdSpec, argv, err := t.Effects.CheckArgs(args)
+    if err != nil { return Result{}, err }
+    eff := t.Effects
+    attr, err := sandboxAttr(eff.Network)
+    if err != nil { return Result{}, err }
+    ctx, cancel := context.WithTimeout(ctx, time.Duration(eff.TimeoutMs)*time.Millisecond)
+    defer cancel()
+
+    // the limits are set by a wrapper that then execs the command
+    prog, wargs, err := limitedCommand(cmdSpec.Path, argv, eff)
+    if err != nil { return Result{}, err }
+    cmd := exec.CommandContext(ctx, prog, wargs...)
+    cmd.Dir = eff.Dir
+    cmd.Env = execEnv(eff.Env)
+    cmd.SysProcAttr = attr
+    // keep one byte past the cap so truncation is detected
+    stdout := &cappedBuffer{max: eff.MaxOutputBytes + 1}
+    stderr := &cappedBuffer{max: execStderrBytes}
+    cmd.Stdout, cmd.Stderr = stdout, stderr
+    // on timeout the whole process group goes, so children cannot hold the pipes open
+    cmd.Cancel = func() error { return killGroup(cmd.Process.Pid) }
+    cmd.WaitDelay = time.Second
+    start := time.Now()
+    if err := cmd.Start(); err != nil { return Result{}, fmt.Errorf("exec.run: %w", err) }
+    err = cmd.Wait()
+    _ = killGroup(cmd.Process.Pid)
+    if ctx.Err() != nil { return Result{}, fmt.Errorf("exec.run: %w", ctx.Err()) }
+    var ee *exec.ExitError
+    if errors.As(err, &ee) { return Result{}, exitError(ee, stderr.String()) }
+    if err != nil { return Result{}, fmt.Errorf("exec.run: %w", err) }
+
+    out := stdout.String()
+    truncated := int64(len(out)) > eff.MaxOutputBytes
+    if truncated { out = truncateUTF8(out, int(eff.MaxOutputBytes)) }
+    sum := sha256.Sum256([]byte(out))
+    meta := map[string]any{"cmd": cmdSpec.Name, "args": argv, "exitCode": 0, "bytes": len(out), "truncated": truncated, "durationMs": time.Since(start).Milliseconds(), "bodyHash": "sha256:" + hex.EncodeToString(sum[:])}
+    if s := stderr.String(); s != "" { meta["stderr"] = s }
+    return Result{Output: out, Meta: meta}, nil
+}
+
+// execEnv passes through the allowlisted variables that are set.
+func execEnv(names []string) []string {
+    env := []string{}
+    for _, n := range names {
+        if v, ok := os.LookupEnv(n); ok { env = append(env, n+"="+v) }
+    }
+    return env
+}
+
+// cappedBuffer keeps the first max bytes written and discards the rest, so a
+// chatty command is never blocked on a full pipe.
+type cappedBuffer struct {
+    b   bytes.Buffer
+    max int64
+}
+
+func (c *cappedBuffer) Write(p []byte) (int, error) {
+    room := c.max - int64(c.b.Len())
+    if int64(len(p)) > room {
+        if room > 0 { c.b.Write(p[:room]) }
+        return len(p), nil
+    }
+    return c.b.Write(p)
+}
+
+func (c *cappedBuffer) String() string { return c.b.String() }
@@ -0,0 +1,247 @@
+package ais
+
+import (
+    "context"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "time"
+)
+
+// ResultReport says what CheckResult did to a tool result, for the audit log.
+type ResultReport struct {
+    Redaction RedactionReport
+    DLP       DLPReport
+}
+
+// AddTo sets the "redaction" and "dlp" fields of an audit event when there
+// is something to report.
+func (r ResultReport) AddTo(ev map[string]any) {
+    if r.Redaction.Tokenized != nil || r.Redaction.Masked != nil { ev["redaction"] = r.Redaction }
+    if r.DLP.Counts != nil { ev["dlp"] = r.DLP }
+}
+
+// CheckResult runs the result-side checks every executor applies to a tool's
+// output: the injection scan (not for ollama.generate, whose output is the
+// model's own), the APr's redaction obligations, then DLP. Injection and DLP
+// blocks are guard denials (*InjectionError, *DLPError); other errors are
+// the executor's own.
+func CheckResult(cfg GuardConfig, tool string, uia UIA, apr APr, out string) (string, ResultReport, error) {
+    var rep ResultReport
+    // fetched content is untrusted: refuse to hand injected instructions back to the agent
+    if cfg.Injection != nil && tool != "ollama.generate" {
+        if f := cfg.Injection.Scan("result", out); cfg.Injection.Blocked(f) { return "", rep, &InjectionError{Findings: f} }
+    }
+    var err error
+    if cfg.Redactor != nil {
+        if out, rep.Redaction, err = cfg.Redactor.Apply(apr.Evidence.Obligations, uia.ID, out); err != nil { return "", rep, err }
+    }
+    // label what the tool actually returned; classes the UIA lacks are blocked or redacted
+    if cfg.DLP != nil {
+        if out, rep.DLP, err = cfg.DLP.Enforce(uia, out); err != nil { return "", rep, err }
+    }
+    return out, rep, nil
+}
+
+// PlanEvent is a progress event of Executor.Run. A run emits "plan" with
+// the artifacts, then per step "step.skip", or "step.start" and one of
+// "step.done", "step.deny" or "step.error" ("step.approval" before a
+// consent wait), and "done" last with the outputs of the steps that
+// completed.
+type PlanEvent struct {
+    Event   string            `json:"event"`
+    Step    string            `json:"step,omitempty"`
+    Tool    string            `json:"tool,omitempty"`
+    IBE     string            `json:"ibe,omitempty"`
+    Output  string            `json:"output,omitempty"`
+    Code    string            `json:"code,omitempty"`
+    Message string            `json:"message,omitempty"`
+    Details map[string]any    `json:"details,omitempty"`
+    Result  map[string]any    `json:"result,omitempty"`
+    UIA     *UIA              `json:"uia,omitempty"`
+    APA     *APA              `json:"apa,omitempty"`
+    APr     *APr              `json:"apr,omitempty"`
+    Outputs map[string]string `json:"outputs,omitempty"`
+}
+
+// StepError stops a plan run: Code is the guard's denial or the tool error's
+// code for Step.
+type StepError struct {
+    Step string
+    Code string
+    Err  error
+}
+
+func (e *StepError) Error() string { return e.Code }
+
+func (e *StepError) Unwrap() error { return e.Err }
+
+// Executor runs the steps of one APA under one APr, minting and verifying an
+// IBE per step. Steps run in plan order. A step whose guard (When) is false
+// is skipped, as is one whose args reference a skipped step; references to
+// earlier outputs are filled in before the guard checks the call. The run
+// stops at the first denial or tool error.
+type Executor struct {
+    Tools  *ToolRegistry
+    Config func() GuardConfig
+    // IBETTL is the lifetime of each minted IBE; 0 means two minutes.
+    IBETTL time.Duration
+    // Audit receives a guard.deny or tool-call event per step; nil drops them.
+    Audit func(ev map[string]any)
+    // Challenge, if set, handles AUTHZ-NEED-CONSENT (e.g. by queueing the step
+    // for approval) and returns details for the event.
+    Challenge func(uia UIA, apa APA, apr APr, step APAStep) map[string]any
+    // AwaitConsent, if set, blocks until the challenge described by details
+    // is decided and reports whether it was approved; the step is then
+    // retried with a fresh IBE. Without it a challenge stops the run.
+    AwaitConsent func(ctx context.Context, details map[string]any) bool
+    // ToolError maps a tool failure to an error code and details; nil
+    // reports every failure as SYS-RETRY.
+    ToolError func(err error) (string, map[string]any)
+}
+
+// Run executes apa, sending progress to emit, and returns the output of each
+// completed step. A stopped run returns a *StepError.
+func (x *Executor) Run(ctx context.Context, uia UIA, apa APA, apr APr, emit func(PlanEvent)) (map[string]string, error) {
+    emit(PlanEvent{Event: "plan", UIA: &uia, APA: &apa, APr: &apr})
+    outputs, skipped := map[string]string{}, map[string]bool{}
+    stop := func(err *StepError) (map[string]string, error) {
+        emit(PlanEvent{Event: "done", Code: err.Code, Step: err.Step, Outputs: outputs})
+        return outputs, err
+    }
+    if err := ValidatePlan(apa); err != nil {
+        emit(PlanEvent{Event: "step.deny", Code: err.Error(), Message: planReason(err)})
+        return stop(&StepError{Code: err.Error(), Err: err})
+    }
+    for _, step := range apa.Steps {
+        why, err := skipReason(uia, apa, step, outputs, skipped)
+        if err != nil {
+            emit(PlanEvent{Event: "step.deny", Step: step.ID, Tool: step.Tool, Code: "APA-PLAN-INVALID", Message: "when: " + err.Error()})
+            return stop(&StepError{Step: step.ID, Code: "APA-PLAN-INVALID", Err: err})
+        }
+        if why != "" {
+            skipped[step.ID] = true
+            emit(PlanEvent{Event: "step.skip", Step: step.ID, Tool: step.Tool, Message: why})
+            continue
+        }
+        if err := x.runStep(ctx, uia, apa, apr, step, outputs, emit); err != nil { return stop(err) }
+    }
+    emit(PlanEvent{Event: "done", Outputs: outputs})
+    return outputs, nil
+}
+
+// skipReason says why a step does not run: it needs the output of a skipped
+// step, or its guard is false. Guards see uia, apa and the settled steps.
+func skipReason(uia UIA, apa APA, step APAStep, outputs map[string]string, skipped map[string]bool) (string, error) {
+    for _, d := range argRefs(step) {
+        if skipped[d] { return "needs the output of skipped step " + d, nil }
+    }
+    if step.When == "" { return "", nil }
+    e, err := ParseExpr(step.When)
+    if err != nil { return "", err }
+    env := ExprEnv(map[string]any{"uia": uia, "apa": apa})
+    env["steps"] = stepsEnv(outputs, skipped)
+    ok, err := EvalBool(e, env)
+    if err != nil { return "", err }
+    if !ok { return "guard is false: " + step.When, nil }
+    return "", nil
+}
+
+// planReason is the reason of a *PlanError, or the error text.
+func planReason(err error) string {
+    var pe *PlanError
+    if errors.As(err, &pe) { return pe.Reason }
+    return err.Error()
+}
+
+func (x *Executor) runStep(ctx context.Context, uia UIA, apa APA, apr APr, step APAStep, outputs map[string]string, emit func(PlanEvent)) *StepError {
+    cfg := x.Config()
+    tool, ok := x.Tools.Lookup(step.Tool)
+    if !ok {
+        emit(PlanEvent{Event: "step.error", Step: step.ID, Tool: step.Tool, Code: "INPUT-SCHEMA-INVALID", Message: "unknown tool"})
+        return &StepError{Step: step.ID, Code: "INPUT-SCHEMA-INVALID"}
+    }
+    var ibe IBE
+    // the IBE covers the step as planned; the guard checks the filled-in args against it
+    args, err := ResolveArgs(step.Args, outputs)
+    if err != nil { return x.deny(emit, err, "step references an output that is not available", nil, ibe, uia, apa, apr, step) }
+    for {
+        if ibe, err = x.mintIBE(cfg, uia, apr, step, tool.TCA()); err != nil { return x.fail(emit, step, ibe, err) }
+        emit(PlanEvent{Event: "step.start", Step: step.ID, Tool: step.Tool, IBE: ibe.ID})
+        err = VerifyIBEArgsContext(ctx, cfg, ibe, apr, uia, apa, tool.TCA(), args)
+        if err == nil || err.Error() != "AUTHZ-NEED-CONSENT" || x.Challenge == nil { break }
+        details := x.Challenge(uia, apa, apr, step)
+        if x.AwaitConsent == nil { return x.deny(emit, err, "step requires approval", details, ibe, uia, apa, apr, step) }
+        emit(PlanEvent{Event: "step.approval", Step: step.ID, Tool: step.Tool, IBE: ibe.ID, Code: err.Error(), Details: details})
+        if !x.AwaitConsent(ctx, details) { return x.deny(emit, err, "approval not granted", details, ibe, uia, apa, apr, step) }
+        cfg = x.Config()
+    }
+    if err != nil { return x.deny(emit, err, "blocked by guard", nil, ibe, uia, apa, apr, step) }
+
+    ctx = WithObligations(ctx, apr.Evidence.Obligations)
+    hold, err := cfg.Ledger.Reserve(uia, step.Expected.Writes)
+    if err != nil { return x.deny(emit, err, "blocked by guard", nil, ibe, uia, apa, apr, step) }
+    ctx = WithRecordLimit(ctx, hold.Records())
+    res, err := tool.Invoke(ctx, args)
+    hold.Settle(res)
+    if err != nil { return x.fail(emit, step, ibe, err) }
+    out, rep, err := CheckResult(cfg, step.Tool, uia, apr, res.Output)
+    var inj *InjectionError
+    var de *DLPError
+    if errors.As(err, &inj) || errors.As(err, &de) { return x.deny(emit, err, "blocked by guard", nil, ibe, uia, apa, apr, step) }
+    if err != nil { return x.fail(emit, step, ibe, err) }
+    out = ApplyObligations(apr.Evidence.Obligations, out)
+    outputs[step.ID] = out
+    sum := sha256.Sum256([]byte(out))
+    ev := map[string]any{"ts": time.Now().UTC().Format(time.RFC3339), "transport": "plan", "uia": uia.ID, "apa": apa.ID, "ibe": ibe.ID, "step": step.ID, "tool": step.Tool, "ok": true, "resultHash": hex.EncodeToString(sum[:]), "result": res.Meta, "writes": res.Writes, "records": res.Records, "spent": cfg.Ledger.Usage(uia.ID)}
+    rep.AddTo(ev)
+    x.audit(ev)
+    emit(PlanEvent{Event: "step.done", Step: step.ID, Tool: step.Tool, IBE: ibe.ID, Output: out, Result: res.Meta})
+    return nil
+}
+
+// mintIBE signs an IBE binding one step of the plan to the tool's TCA.
+func (x *Executor) mintIBE(cfg GuardConfig, uia UIA, apr APr, step APAStep, tca TCA) (IBE, error) {
+    ttl := x.IBETTL
+    if ttl <= 0 { ttl = 2 * time.Minute }
+    b := make([]byte, 16)
+    if _, err := rand.Read(b); err != nil { return IBE{}, err }
+    ibe := IBE{Type: "IBE", ID: "urn:ibe:" + hex.EncodeToString(b[:8]), UIARef: uia.ID, APAStepRef: step.ID, APrRef: apr.ID, TCARef: tca.ID, Nonce: hex.EncodeToString(b[8:]), Exp: time.Now().Add(ttl)}
+    sig, err := SignJWSObject(cfg.Secret, ibe)
+    if err != nil { return IBE{}, err }
+    ibe.Sig = sig
+    return ibe, nil
+}
+
+// deny audits a guard denial and emits step.deny.
+func (x *Executor) deny(emit func(PlanEvent), err error, msg string, details map[string]any, ibe IBE, uia UIA, apa APA, apr APr, step APAStep) *StepError {
+    code := err.Error()
+    if details == nil { details = map[string]any{} }
+    details["ibe"] = ibe.ID
+    ev := map[string]any{"ts": time.Now().UTC().Format(time.RFC3339), "event": "guard.deny", "transport": "plan", "code": code, "uia": uia.ID, "apa": apa.ID, "apr": apr.ID, "ibe": ibe.ID, "tca": ibe.TCARef, "step": step.ID, "tool": step.Tool, "ok": false}
+    var pd *PolicyDenyError
+    if errors.As(err, &pd) { ev["reasons"], details["reasons"] = pd.Reasons, pd.Reasons }
+    var inj *InjectionError
+    if errors.As(err, &inj) { ev["findings"], details["findings"] = inj.Findings, inj.Findings }
+    var de *DLPError
+    if errors.As(err, &de) { ev["dlp"], details["dlp"] = de.Report, de.Report }
+    var pe *PlanError
+    if errors.As(err, &pe) { ev["reason"], details["reason"] = pe.Reason, pe.Reason }
+    x.audit(ev)
+    emit(PlanEvent{Event: "step.deny", Step: step.ID, Tool: step.Tool, IBE: ibe.ID, Code: code, Message: msg, Details: details})
+    return &StepError{Step: step.ID, Code: code, Err: err}
+}
+
+// fail audits a tool (or executor) failure and emits step.error.
+func (x *Executor) fail(emit func(PlanEvent), step APAStep, ibe IBE, err error) *StepError {
+    code, details := "SYS-RETRY", map[string]any(nil)
+    if x.ToolError != nil { code, details = x.ToolError(err) }
+    x.audit(map[string]any{"ts": time.Now().UTC().Format(time.RFC3339), "transport": "plan", "uia": ibe.UIARef, "ibe": ibe.ID, "step": step.ID, "tool": step.Tool, "ok": false, "error": err.Error()})
+    emit(PlanEvent{Event: "step.error", Step: step.ID, Tool: step.Tool, IBE: ibe.ID, Code: code, Message: err.Error(), Details: details})
+    return &StepError{Step: step.ID, Code: code, Err: err}
+}
+
+func (x *Executor) audit(ev map[string]any) {
+    if x.Audit != nil { x.Audit(ev) }
+}
@@ -0,0 +1,546 @@
+package ais
+
+import (
+    "encoding/json"
+    "fmt"
+    "reflect"
+    "regexp"
+    "strconv"
+    "strings"
+    "sync"
+    "unicode"
+)
+
+// Expr is a compiled rule expression. The language is a small, side-effect
+// free subset shared by policy rules and plan guards:
+//
+//   literals   1, 0.5, 'text', "text", true, false, null, [a, b]
+//   paths      uia.constraints.dataClasses, step.args.url, steps.s1.output, list[0]
+//   operators  || && ! == != < <= > >= in + -
+//   functions  lower(s) upper(s) contains(s, sub) startsWith(s, p) endsWith(s, p)
+//              hasAny(s, terms) matches(s, re) json(x) len(x) count(list, v)
+//
+// Missing paths evaluate to null; null compares as 0 against numbers. "in"
+// tests list membership, substring or map key depending on the right operand.
+type Expr interface {
+    Eval(env map[string]any) (any, error)
+}
+
+// ParseExpr compiles an expression.
+func ParseExpr(src string) (Expr, error) {
+    toks, err := lexExpr(src)
+    if err != nil { return nil, err }
+    p := &exprParser{toks: toks}
+    e, err := p.parseOr()
+    if err != nil { return nil, err }
+    if p.peek().kind != tkEOF { return nil, fmt.Errorf("expr %q: unexpected %q", src, p.peek().text) }
+    return e, nil
+}
+
+// EvalBool evaluates e and requires a boolean result.
+func EvalBool(e Expr, env map[string]any) (bool, error) {
+    v, err := e.Eval(env)
+    if err != nil { return false, err }
+    b, ok := v.(bool)
+    if !ok { return false, fmt.Errorf("expected boolean, got %T", v) }
+    return b, nil
+}
+
+// ExprEnv converts values to the generic JSON shape expressions operate on.
+func ExprEnv(vars map[string]any) map[string]any {
+    env := make(map[string]any, len(vars))
+    for k, v := range vars { env[k] = toGeneric(v) }
+    return env
+}
+
+func toGeneric(v any) any {
+    switch v.(type) {
+    case nil, string, bool, float64, map[string]any, []any:
+        return v
+    }
+    b, err := marshalCanonical(v)
+    if err != nil { return nil }
+    var out any
+    if err := json.Unmarshal(b, &out); err != nil { return nil }
+    return out
+}
+
+// --- lexer ---
+
+const (
+    tkEOF = iota
+    tkNum
+    tkStr
+    tkIdent
+    tkOp
+)
+
+type exprTok struct {
+    kind int
+    text string
+}
+
+func lexExpr(src string) ([]exprTok, error) {
+    var toks []exprTok
+    rs := []rune(src)
+    for i := 0; i < len(rs); {
+        r := rs[i]
+        switch {
+        case unicode.IsSpace(r):
+            i++
+        case unicode.IsDigit(r):
+            j := i
+            for j < len(rs) && (unicode.IsDigit(rs[j]) || rs[j] == '.') { j++ }
+            toks = append(toks, exprTok{tkNum, string(rs[i:j])})
+            i = j
+        case r == '\'' || r == '"':
+            var sb strings.Builder
+            j := i + 1
+            for ; j < len(rs) && rs[j] != r; j++ {
+                if rs[j] == '\\' && j+1 < len(rs) { j++ }
+                sb.WriteRune(rs[j])
+            }
+            if j >= len(rs) { return nil, fmt.Errorf("expr %q: unterminated string", src) }
+            toks = append(toks, exprTok{tkStr, sb.String()})
+            i = j + 1
+        case unicode.IsLetter(r) || r == '_' || r == '$':
+            j := i
+            for j < len(rs) && (unicode.IsLetter(rs[j]) || unicode.IsDigit(rs[j]) || rs[j] == '_' || rs[j] == '$') { j++ }
+            toks = append(toks, exprTok{tkIdent, string(rs[i:j])})
+            i = j
+        default:
+            two := ""
+            if i+1 < len(rs) { two = string(rs[i : i+2]) }
+            switch two {
+            case "||", "&&", "==", "!=", "<=", ">=":
+                toks = append(toks, exprTok{tkOp, two})
+                i += 2
+                continue
+            }
+            if strings.ContainsRune("!<>+-().,[]", r) {
+                toks = append(toks, exprTok{tkOp, string(r)})
+                i++
+                continue
+            }
+            return nil, fmt.Errorf("expr %q: unexpected %q", src, string(r))
+        }
+    }
+    return append(toks, exprTok{kind: tkEOF}), nil
+}
+
+// --- parser ---
+
+type exprParser struct {
+    toks []exprTok
+    pos  int
+}
+
+func (p *exprParser) peek() exprTok { return p.toks[p.pos] }
+func (p *exprParser) next() exprTok { t := p.toks[p.pos]; if t.kind != tkEOF { p.pos++ }; return t }
+func (p *exprParser) accept(op string) bool {
+    if t := p.peek(); (t.kind == tkOp || t.kind == tkIdent) && t.text == op { p.pos++; return true }
+    return false
+}
+func (p *exprParser) expect(op string) error {
+    if !p.accept(op) { return fmt.Errorf("expected %q, got %q", op, p.peek().text) }
+    return nil
+}
+
+func (p *exprParser) parseOr() (Expr, error) {
+    l, err := p.parseAnd()
+    if err != nil { return nil, err }
+    for p.accept("||") {
+        r, err := p.parseAnd()
+        if err != nil { return nil, err }
+        l = binExpr{"||", l, r}
+    }
+    return l, nil
+}
+
+func (p *exprParser) parseAnd() (Expr, error) {
+    l, err := p.parseNot()
+    if err != nil { return nil, err }
+    for p.accept("&&") {
+        r, err := p.parseNot()
+        if err != nil { return nil, err }
+        l = binExpr{"&&", l, r}
+    }
+    return l, nil
+}
+
+func (p *exprParser) parseNot() (Expr, error) {
+    if p.accept("!") {
+        e, err := p.parseNot()
+        if err != nil { return nil, err }
+        return notExpr{e}, nil
+    }
+    return p.parseCmp()
+}
+
+func (p *exprParser) parseCmp() (Expr, error) {
+    l, err := p.parseAdd()
+    if err != nil { return nil, err }
+    for _, op := range []string{"==", "!=", "<=", ">=", "<", ">", "in"} {
+        if p.accept(op) {
+            r, err := p.parseAdd()
+            if err != nil { return nil, err }
+            return binExpr{op, l, r}, nil
+        }
+    }
+    return l, nil
+}
+
+func (p *exprParser) parseAdd() (Expr, error) {
+    l, err := p.parseUnary()
+    if err != nil { return nil, err }
+    for {
+        op := p.peek().text
+        if p.peek().kind != tkOp || (op != "+" && op != "-") { return l, nil }
+        p.next()
+        r, err := p.parseUnary()
+        if err != nil { return nil, err }
+        l = binExpr{op, l, r}
+    }
+}
+
+func (p *exprParser) parseUnary() (Expr, error) {
+    if p.accept("-") {
+        e, err := p.parseUnary()
+        if err != nil { return nil, err }
+        return binExpr{"-", litExpr{0.0}, e}, nil
+    }
+    return p.parsePostfix()
+}
+
+func (p *exprParser) parsePostfix() (Expr, error) {
+    e, err := p.parsePrimary()
+    if err != nil { return nil, err }
+    for {
+        switch {
+        case p.accept("."):
+            t := p.next()
+            if t.kind != tkIdent { return nil, fmt.Errorf("expected field name after '.'") }
+            e = indexExpr{e, litExpr{t.text}}
+        case p.accept("["):
+            idx, err := p.parseOr()
+            if err != nil { return nil, err }
+            if err := p.expect("]"); err != nil { return nil, err }
+            e = indexExpr{e, idx}
+        default:
+            return e, nil
+        }
+    }
+}
+
+func (p *exprParser) parsePrimary() (Expr, error) {
+    t := p.next()
+    switch t.kind {
+    case tkNum:
+        f, err := strconv.ParseFloat(t.text, 64)
+        if err != nil { return nil, err }
+        return litExpr{f}, nil
+    case tkStr:
+        return litExpr{t.text}, nil
+    case tkIdent:
+        switch t.text {
+        case "true":
+            return litExpr{true}, nil
+        case "false":
+            return litExpr{false}, nil
+        case "null":
+            return litExpr{nil}, nil
+        }
+        if p.accept("(") {
+            fn, ok := exprFuncs[t.text]
+            if !ok { return nil, fmt.Errorf("unknown function %q", t.text) }
+            var args []Expr
+            for !p.accept(")") {
+                if len(args) > 0 { if err := p.expect(","); err != nil { return nil, err } }
+                a, err := p.parseOr()
+                if err != nil { return nil, err }
+                args = append(args, a)
+            }
+            return callExpr{t.text, fn, args}, nil
+        }
+        return varExpr{t.text}, nil
+    case tkOp:
+        switch t.text {
+        case "(":
+            e, err := p.parseOr()
+            if err != nil { return nil, err }
+            return e, p.expect(")")
+        case "[":
+            var items []Expr
+            for !p.accept("]") {
+                if len(items) > 0 { if err := p.expect(","); err != nil { return nil, err } }
+                a, err := p.parseOr()
+                if err != nil { return nil, err }
+                items = append(items, a)
+            }
+            return listExpr{items}, nil
+        }
+    }
+    return nil, fmt.Errorf("unexpected %q", t.text)
+}
+
+// --- evaluation ---
+
+type litExpr struct{ v any }
+type varExpr struct{ name string }
+type indexExpr struct{ base, key Expr }
+type listExpr struct{ items []Expr }
+type notExpr struct{ e Expr }
+type binExpr struct {
+    op   string
+    l, r Expr
+}
+type callExpr struct {
+    name string
+    fn   func([]any) (any, error)
+    args []Expr
+}
+
+func (e litExpr) Eval(map[string]any) (any, error) { return e.v, nil }
+func (e varExpr) Eval(env map[string]any) (any, error) { return env[e.name], nil }
+
+func (e indexExpr) Eval(env map[string]any) (any, error) {
+    b, err := e.base.Eval(env)
+    if err != nil { return nil, err }
+    k, err := e.key.Eval(env)
+    if err != nil { return nil, err }
+    switch x := b.(type) {
+    case map[string]any:
+        s, _ := k.(string)
+        return x[s], nil
+    case []any:
+        f, ok := k.(float64)
+        if !ok || f < 0 || int(f) >= len(x) { return nil, nil }
+        return x[int(f)], nil
+    }
+    return nil, nil
+}
+
+func (e listExpr) Eval(env map[string]any) (any, error) {
+    out := make([]any, 0, len(e.items))
+    for _, it := range e.items {
+        v, err := it.Eval(env)
+        if err != nil { return nil, err }
+        out = append(out, v)
+    }
+    return out, nil
+}
+
+func (e notExpr) Eval(env map[string]any) (any, error) {
+    b, err := EvalBool(e.e, env)
+    return !b, err
+}
+
+func (e binExpr) Eval(env map[string]any) (any, error) {
+    if e.op == "&&" || e.op == "||" {
+        l, err := EvalBool(e.l, env)
+        if err != nil { return nil, err }
+        if e.op == "&&" && !l || e.op == "||" && l { return l, nil }
+        return EvalBool(e.r, env)
+    }
+    l, err := e.l.Eval(env)
+    if err != nil { return nil, err }
+    r, err := e.r.Eval(env)
+    if err != nil { return nil, err }
+    switch e.op {
+    case "==":
+        return exprEqual(l, r), nil
+    case "!=":
+        return !exprEqual(l, r), nil
+    case "in":
+        return exprIn(l, r), nil
+    case "+":
+        if ls, ok := l.(string); ok { return ls + exprString(r), nil }
+    }
+    lf, lok := exprNum(l, r)
+    rf, rok := exprNum(r, l)
+    if !lok || !rok { return nil, fmt.Errorf("operator %s needs numbers, got %T and %T", e.op, l, r) }
+    switch e.op {
+    case "<":
+        return lf < rf, nil
+    case "<=":
+        return lf <= rf, nil
+    case ">":
+        return lf > rf, nil
+    case ">=":
+        return lf >= rf, nil
+    case "+":
+        return lf + rf, nil
+    case "-":
+        return lf - rf, nil
+    }
+    return nil, fmt.Errorf("unknown operator %s", e.op)
+}
+
+func (e callExpr) Eval(env map[string]any) (any, error) {
+    args := make([]any, len(e.args))
+    for i, a := range e.args {
+        v, err := a.Eval(env)
+        if err != nil { return nil, err }
+        args[i] = v
+    }
+    v, err := e.fn(args)
+    if err != nil { return nil, fmt.Errorf("%s: %w", e.name, err) }
+    return v, nil
+}
+
+// exprStepRefs lists the step ids e reads as steps.<id>; ok is false when e
+// reads steps any other way (e.g. steps[x]), so its inputs are not static.
+func exprStepRefs(e Expr) (ids []string, ok bool) {
+    ok = true
+    var walk func(Expr)
+    walk = func(e Expr) {
+        switch x := e.(type) {
+        case varExpr:
+            if x.name == "steps" { ok = false }
+        case indexExpr:
+            if v, isVar := x.base.(varExpr); isVar && v.name == "steps" {
+                if k, isLit := x.key.(litExpr); isLit {
+                    if id, isStr := k.v.(string); isStr { ids = append(ids, id); return }
+                }
+                ok = false
+                return
+            }
+            walk(x.base)
+            walk(x.key)
+        case listExpr:
+            for _, it := range x.items { walk(it) }
+        case notExpr:
+            walk(x.e)
+        case binExpr:
+            walk(x.l)
+            walk(x.r)
+        case callExpr:
+            for _, a := range x.args { walk(a) }
+        }
+    }
+    walk(e)
+    return ids, ok
+}
+
+// exprNum converts v to a number; null counts as 0 when other is a number.
+func exprNum(v, other any) (float64, bool) {
+    switch x := v.(type) {
+    case float64:
+        return x, true
+    case nil:
+        _, ok := other.(float64)
+        return 0, ok
+    }
+    return 0, false
+}
+
+func exprEqual(a, b any) bool {
+    if af, ok := a.(float64); ok {
+        bf, ok := b.(float64)
+        return ok && af == bf
+    }
+    return reflect.DeepEqual(a, b)
+}
+
+func exprIn(needle, hay any) bool {
+    switch h := hay.(type) {
+    case []any:
+        for _, x := range h { if exprEqual(needle, x) { return true } }
+    case string:
+        s, ok := needle.(string)
+        return ok && strings.Contains(h, s)
+    case map[string]any:
+        s, ok := needle.(string)
+        if ok { _, found := h[s]; return found }
+    }
+    return false
+}
+
+func exprString(v any) string {
+    switch x := v.(type) {
+    case nil:
+        return ""
+    case string:
+        return x
+    case float64:
+        return strconv.FormatFloat(x, 'f', -1, 64)
+    }
+    b, _ := marshalCanonical(v)
+    return string(b)
+}
+
+func strArgs(args []any, n int) ([]string, error) {
+    if len(args) != n { return nil, fmt.Errorf("want %d arguments, got %d", n, len(args)) }
+    out := make([]string, n)
+    for i, a := range args {
+        if a == nil { continue }
+        s, ok := a.(string)
+        if !ok { return nil, fmt.Errorf("argument %d: want string, got %T", i+1, a) }
+        out[i] = s
+    }
+    return out, nil
+}
+
+// maxRegexCache bounds the compiled `matches` patterns. `when` guards can come
+// from client-supplied APAs, so the cache is dropped when full rather than
+// growing with every distinct pattern a caller sends.
+const maxRegexCache = 256
+
+var regexCache = struct{ sync.Mutex; m map[string]*regexp.Regexp }{m: map[string]*regexp.Regexp{}}
+
+var exprFuncs = map[string]func([]any) (any, error){
+    "lower": func(a []any) (any, error) { s, err := strArgs(a, 1); if err != nil { return nil, err }; return strings.ToLower(s[0]), nil },
+    "upper": func(a []any) (any, error) { s, err := strArgs(a, 1); if err != nil { return nil, err }; return strings.ToUpper(s[0]), nil },
+    "contains": func(a []any) (any, error) { s, err := strArgs(a, 2); if err != nil { return nil, err }; return strings.Contains(s[0], s[1]), nil },
+    "startsWith": func(a []any) (any, error) { s, err := strArgs(a, 2); if err != nil { return nil, err }; return strings.HasPrefix(s[0], s[1]), nil },
+    "endsWith": func(a []any) (any, error) { s, err := strArgs(a, 2); if err != nil { return nil, err }; return strings.HasSuffix(s[0], s[1]), nil },
+    "matches": func(a []any) (any, error) {
+        s, err := strArgs(a, 2)
+        if err != nil { return nil, err }
+        regexCache.Lock()
+        re, ok := regexCache.m[s[1]]
+        if !ok {
+            if re, err = regexp.Compile(s[1]); err == nil {
+                if len(regexCache.m) >= maxRegexCache { regexCache.m = map[string]*regexp.Regexp{} }
+                regexCache.m[s[1]] = re
+            }
+        }
+        regexCache.Unlock()
+        if err != nil { return nil, err }
+        return re.MatchString(s[0]), nil
+    },
+    "hasAny": func(a []any) (any, error) {
+        if len(a) != 2 { return nil, fmt.Errorf("want 2 arguments") }
+        s, _ := a[0].(string)
+        terms, _ := a[1].([]any)
+        for _, t := range terms { if ts, ok := t.(string); ok && ts != "" && strings.Contains(s, ts) { return true, nil } }
+        return false, nil
+    },
+    // json serializes a value, so rules can search args whose shape is not known
+    // in advance (e.g. tools of a proxied MCP server)
+    "json": func(a []any) (any, error) {
+        if len(a) != 1 { return nil, fmt.Errorf("want 1 argument") }
+        b, err := json.Marshal(a[0])
+        if err != nil { return nil, err }
+        return string(b), nil
+    },
+    "len": func(a []any) (any, error) {
+        if len(a) != 1 { return nil, fmt.Errorf("want 1 argument") }
+        switch x := a[0].(type) {
+        case string:
+            return float64(len(x)), nil
+        case []any:
+            return float64(len(x)), nil
+        case map[string]any:
+            return float64(len(x)), nil
+        }
+        return 0.0, nil
+    },
+    "count": func(a []any) (any, error) {
+        if len(a) != 2 { return nil, fmt.Errorf("want 2 arguments") }
+        list, _ := a[0].([]any)
+        n := 0
+        for _, x := range list { if exprEqual(x, a[1]) { n++ } }
+        return float64(n), nil
+    },
+}
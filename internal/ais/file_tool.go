@@ -0,0 +1,244 @@
+package ais
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "path"
+    "path/filepath"
+    "sort"
+    "strings"
+)
+
+// DefaultFileMaxBytes caps file.read output when FileScope.MaxBytes is 0.
+const DefaultFileMaxBytes = 64 << 10
+
+// ErrPathNotAllowed is returned for paths that escape the scope's roots,
+// traverse with "..", or do not match its globs.
+var ErrPathNotAllowed = errors.New("PATH-NOT-ALLOWED")
+
+// Label files. A sidecar "<name>.labels.json" labels one file; a directory's
+// ".labels.json" labels its files by glob and sets a default for the
+// directory. The nearest label wins, then DefaultLabels.
+const (
+    labelSidecarSuffix = ".labels.json"
+    labelDirFile       = ".labels.json"
+)
+
+type fileLabels struct {
+    DataClasses []string            `json:"dataClasses"`
+    Files       map[string][]string `json:"files,omitempty"`
+}
+
+// FileScope is the filesystem view shared by file.read and file.list. Paths
+// are resolved through symlinks and must stay inside a root; files must also
+// match one of Globs (root-relative, "**" spans directories) if any are set.
+type FileScope struct {
+    Roots         []string
+    Globs         []string
+    MaxBytes      int64
+    DefaultLabels []string
+}
+
+// TCA declares both operations with the scope's roots and globs.
+func (s *FileScope) TCA() TCA {
+    eff := OperationEffects{Writes: 0, DataClasses: s.DefaultLabels, Roots: s.Roots, Globs: s.Globs}
+    return TCA{ID: "urn:tca:file@1", Operator: "local", Operations: []TCAOperation{{Name: "file.list", Effects: eff}, {Name: "file.read", Effects: eff}}}
+}
+
+// Resolve maps a path arg (relative to the first root, or absolute) to a real
+// path inside a root, returning the root and the slash-separated path
+// relative to it.
+func (s *FileScope) Resolve(p string) (real, root, rel string, err error) {
+    if len(s.Roots) == 0 { return "", "", "", fmt.Errorf("%w: no roots configured", ErrPathNotAllowed) }
+    for _, part := range strings.Split(filepath.ToSlash(p), "/") {
+        if part == ".." { return "", "", "", fmt.Errorf("%w: %s", ErrPathNotAllowed, p) }
+    }
+    if !filepath.IsAbs(p) { p = filepath.Join(s.Roots[0], p) }
+    return s.resolveJoined(p)
+}
+
+// resolveJoined resolves a path already joined to a root.
+func (s *FileScope) resolveJoined(p string) (real, root, rel string, err error) {
+    real, err = filepath.EvalSymlinks(p)
+    if err != nil { return "", "", "", err }
+    for _, r := range s.Roots {
+        rr, err := filepath.EvalSymlinks(r)
+        if err != nil { continue }
+        if rel, err := filepath.Rel(rr, real); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+            return real, rr, filepath.ToSlash(rel), nil
+        }
+    }
+    return "", "", "", fmt.Errorf("%w: %s", ErrPathNotAllowed, p)
+}
+
+// matches reports whether a root-relative file path is visible in the scope.
+func (s *FileScope) matches(rel string) bool {
+    if strings.HasSuffix(rel, labelSidecarSuffix) { return false }
+    if len(s.Globs) == 0 { return true }
+    for _, g := range s.Globs { if globMatch(g, rel) { return true } }
+    return false
+}
+
+// Labels returns the data classes of a resolved path inside root.
+func (s *FileScope) Labels(real, root string) ([]string, error) {
+    fi, err := os.Stat(real)
+    if err != nil { return nil, err }
+    if !fi.IsDir() {
+        if l, ok, err := readLabels(real + labelSidecarSuffix); err != nil || ok { return l.DataClasses, err }
+    }
+    dir, name := real, ""
+    if !fi.IsDir() { dir, name = filepath.Dir(real), filepath.Base(real) }
+    for {
+        l, ok, err := readLabels(filepath.Join(dir, labelDirFile))
+        if err != nil { return nil, err }
+        if ok {
+            globs := make([]string, 0, len(l.Files))
+            for g := range l.Files { globs = append(globs, g) }
+            sort.Strings(globs)
+            for _, g := range globs { if name != "" && globMatch(g, name) { return l.Files[g], nil } }
+            if l.DataClasses != nil { return l.DataClasses, nil }
+        }
+        if dir == root || len(dir) <= len(root) { break }
+        // in ancestor directories, file globs match the path from that directory
+        if name != "" { name = filepath.Base(dir) + "/" + name }
+        dir = filepath.Dir(dir)
+    }
+    return s.DefaultLabels, nil
+}
+
+func readLabels(p string) (fileLabels, bool, error) {
+    b, err := os.ReadFile(p)
+    if errors.Is(err, os.ErrNotExist) { return fileLabels{}, false, nil }
+    if err != nil { return fileLabels{}, false, err }
+    var l fileLabels
+    if err := json.Unmarshal(b, &l); err != nil { return fileLabels{}, false, fmt.Errorf("%s: %w", p, err) }
+    return l, true, nil
+}
+
+// labelPath resolves args["path"] and returns its labels; file.read and
+// file.list share it as their ArgLabeler.
+func (s *FileScope) labelPath(args map[string]any, wantDir bool) ([]string, error) {
+    real, root, _, err := s.resolveArg(args, wantDir)
+    if err != nil { return nil, err }
+    return s.Labels(real, root)
+}
+
+func (s *FileScope) resolveArg(args map[string]any, wantDir bool) (real, root, rel string, err error) {
+    p, _ := args["path"].(string)
+    if p == "" && wantDir { p = "." }
+    real, root, rel, err = s.Resolve(p)
+    if err != nil { return "", "", "", err }
+    fi, err := os.Stat(real)
+    if err != nil { return "", "", "", err }
+    if fi.IsDir() != wantDir {
+        if wantDir { return "", "", "", fmt.Errorf("%s is not a directory", p) }
+        return "", "", "", fmt.Errorf("%s is a directory", p)
+    }
+    if !wantDir && !s.matches(rel) { return "", "", "", fmt.Errorf("%w: %s", ErrPathNotAllowed, p) }
+    return real, root, rel, nil
+}
+
+// FileReadTool is file.read: returns a file's content up to MaxBytes.
+type FileReadTool struct{ *FileScope }
+
+func (FileReadTool) Name() string { return "file.read" }
+
+func (FileReadTool) InputSchema() map[string]any {
+    return map[string]any{"type": "object", "properties": map[string]any{"path": map[string]any{"type": "string", "minLength": 1}}, "required": []string{"path"}}
+}
+
+func (FileReadTool) ValidateArgs(args map[string]any) error {
+    if p, ok := args["path"].(string); !ok || p == "" { return errors.New("path must be a non-empty string") }
+    return nil
+}
+
+func (t FileReadTool) LabelArgs(args map[string]any) ([]string, error) { return t.labelPath(args, false) }
+
+func (t FileReadTool) Invoke(ctx context.Context, args map[string]any) (Result, error) {
+    if err := t.ValidateArgs(args); err != nil { return Result{}, err }
+    real, root, rel, err := t.resolveArg(args, false)
+    if err != nil { return Result{}, err }
+    labels, err := t.Labels(real, root)
+    if err != nil { return Result{}, err }
+    f, err := os.Open(real)
+    if err != nil { return Result{}, err }
+    defer f.Close()
+    maxBytes := t.MaxBytes
+    if maxBytes <= 0 { maxBytes = DefaultFileMaxBytes }
+    b, err := io.ReadAll(io.LimitReader(f, maxBytes+1))
+    if err != nil { return Result{}, err }
+    out, truncated := string(b), int64(len(b)) > maxBytes
+    if truncated { out = truncateUTF8(out, int(maxBytes)) }
+    sum := sha256.Sum256([]byte(out))
+    return Result{Output: out, Meta: map[string]any{"path": rel, "labels": labels, "bytes": len(out), "truncated": truncated, "bodyHash": "sha256:" + hex.EncodeToString(sum[:])}}, nil
+}
+
+// FileListTool is file.list: lists a directory's subdirectories and the
+// files visible in the scope, one per line, directories with a trailing "/".
+type FileListTool struct{ *FileScope }
+
+func (FileListTool) Name() string { return "file.list" }
+
+func (FileListTool) InputSchema() map[string]any {
+    return map[string]any{"type": "object", "properties": map[string]any{"path": map[string]any{"type": "string"}}}
+}
+
+func (FileListTool) ValidateArgs(args map[string]any) error {
+    if p, ok := args["path"]; ok {
+        if _, ok := p.(string); !ok { return errors.New("path must be a string") }
+    }
+    return nil
+}
+
+func (t FileListTool) LabelArgs(args map[string]any) ([]string, error) { return t.labelPath(args, true) }
+
+func (t FileListTool) Invoke(ctx context.Context, args map[string]any) (Result, error) {
+    if err := t.ValidateArgs(args); err != nil { return Result{}, err }
+    real, _, rel, err := t.resolveArg(args, true)
+    if err != nil { return Result{}, err }
+    entries, err := os.ReadDir(real)
+    if err != nil { return Result{}, err }
+    var out []string
+    for _, e := range entries {
+        name := e.Name()
+        if name == labelDirFile { continue }
+        // entries are resolved like any other path so symlinks out of the root are hidden
+        er, _, erel, err := t.resolveJoined(filepath.Join(real, name))
+        if err != nil { continue }
+        fi, err := os.Stat(er)
+        if err != nil { continue }
+        if fi.IsDir() {
+            out = append(out, erel+"/")
+        } else if t.matches(erel) {
+            out = append(out, erel)
+        }
+    }
+    return Result{Output: strings.Join(out, "\n"), Meta: map[string]any{"path": rel, "entries": len(out)}}, nil
+}
+
+// globMatch matches a slash-separated path against a pattern whose segments
+// use path.Match syntax; a "**" segment matches zero or more segments.
+func globMatch(pattern, name string) bool {
+    return globSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func globSegments(pat, segs []string) bool {
+    for len(pat) > 0 {
+        if pat[0] == "**" {
+            for i := 0; i <= len(segs); i++ {
+                if globSegments(pat[1:], segs[i:]) { return true }
+            }
+            return false
+        }
+        if len(segs) == 0 { return false }
+        if ok, _ := path.Match(pat[0], segs[0]); !ok { return false }
+        pat, segs = pat[1:], segs[1:]
+    }
+    return len(segs) == 0
+}
@@ -0,0 +1,36 @@
+package ais
+
+import (
+    "context"
+    "errors"
+)
+
+// GenerateTool is ollama.generate. Client is called per invocation so the
+// model can be switched at runtime.
+type GenerateTool struct { Client func() *OllamaClient }
+
+func (GenerateTool) Name() string { return "ollama.generate" }
+
+func (GenerateTool) TCA() TCA {
+    return TCA{ID: "urn:tca:ollama.generate@1", Operator: "local", Operations: []TCAOperation{{Name: "ollama.generate", Effects: OperationEffects{Writes: 0, DataClasses: []string{"derived"}}}}}
+}
+
+func (GenerateTool) InputSchema() map[string]any {
+    return map[string]any{"type": "object", "properties": map[string]any{"prompt": map[string]any{"type": "string", "minLength": 1}}, "required": []string{"prompt"}}
+}
+
+func (GenerateTool) ValidateArgs(args map[string]any) error {
+    if p, ok := args["prompt"].(string); !ok || len(p) == 0 { return errors.New("prompt must be a non-empty string") }
+    return nil
+}
+
+// Invoke generates from args["prompt"]. It returns ErrModelNotPresent rather
+// than blocking on a pull.
+func (g GenerateTool) Invoke(ctx context.Context, args map[string]any) (Result, error) {
+    if err := g.ValidateArgs(args); err != nil { return Result{}, err }
+    c := g.Client()
+    if ok, _ := c.HasModel(); !ok { return Result{}, ErrModelNotPresent }
+    out, err := c.Generate(args["prompt"].(string))
+    if err != nil { return Result{}, err }
+    return Result{Output: out, Meta: map[string]any{"model": c.Model}}, nil
+}
@@ -1,6 +1,7 @@
 package ais
 
 import (
+    "context"
     "errors"
     "slices"
     "strings"
@@ -8,7 +9,40 @@ import (
     "time"
 )
 
-type GuardConfig struct { Secret []byte; MinAlignment float64; VerifierMethod string }
+type GuardConfig struct {
+    Secret []byte; MinAlignment float64
+    // ConsentLevel enables stepwise consent for UIAs whose risk level is at
+    // least this value; 0 disables it.
+    ConsentLevel   int
+    ElevatedTools  []string
+    ApproverSecret []byte
+    // Consent looks up a previously granted consent token for a step of a
+    // plan under a UIA.
+    Consent func(uiaRef, apaRef, stepRef string) (ConsentToken, bool)
+    // PDP, if set, must allow every call that passed the built-in checks.
+    PDP PolicyDecisionPoint
+    // Calibration, if set, overrides MinAlignment per profile and APr method.
+    Calibration *Calibration
+    // Injection, if set, scans step args for prompt-injection markers.
+    Injection *InjectionScanner
+    // DLP, if set, classifies tool results; executors enforce it after Invoke.
+    DLP *DLPScanner
+    // Redactor, if set, applies the APr's tokenize: and mask: obligations to
+    // tool results before DLP classification.
+    Redactor *Redactor
+    // Tools, if set, resolves the TCA by the IBE's tcaRef, ignoring the TCA
+    // passed by the caller, and supplies per-tool arg validation.
+    Tools *ToolRegistry
+    // Ledger, if set, holds the writes and records each UIA has actually
+    // spent or reserved; they count against its risk budget along with the
+    // step's own.
+    Ledger *Ledger
+}
+
+// PolicyDenyError is AUTHZ-POLICY-DENY carrying the policy's deny reasons.
+type PolicyDenyError struct{ Reasons []string }
+
+func (e *PolicyDenyError) Error() string { return "AUTHZ-POLICY-DENY" }
 
 var (
     nonceSeen = struct{ sync.Mutex; m map[string]time.Time }{m: map[string]time.Time{}}
@@ -16,28 +50,67 @@ var (
         sync.RWMutex
         issued time.Time
         expires time.Time
-        revoked map[string]string // id -> reason
-    }{revoked: map[string]string{}}
+        revoked map[string]crlEntry
+    }{revoked: map[string]crlEntry{}}
 )
 
 // SetCRL updates an in-memory CRL used by VerifyIBE.
 func SetCRL(issued, expires time.Time, ids map[string]string) {
     crl.Lock()
     crl.issued, crl.expires = issued, expires
-    crl.revoked = map[string]string{}
-    for k, v := range ids { crl.revoked[k] = v }
+    crl.revoked = map[string]crlEntry{}
+    for k, v := range ids { crl.revoked[k] = crlEntry{reason: v, until: expires} }
+    crl.Unlock()
+}
+
+// crlEntry is one revocation; a zero until keeps it for the life of the
+// process.
+type crlEntry struct {
+    reason string
+    until  time.Time
+}
+
+// Revoke adds a single id to the in-memory CRL until the given time, or for
+// good when until is zero. Each entry lapses on its own; revoking an id again
+// replaces its entry.
+func Revoke(id, reason string, until time.Time) {
+    now := time.Now()
+    crl.Lock()
+    if crl.issued.IsZero() { crl.issued = now }
+    for k, e := range crl.revoked {
+        if !e.until.IsZero() && now.After(e.until) { delete(crl.revoked, k) }
+    }
+    crl.revoked[id] = crlEntry{reason: reason, until: until}
     crl.Unlock()
 }
 
 func isRevoked(id string, now time.Time) bool {
     crl.RLock()
     defer crl.RUnlock()
-    if crl.expires.IsZero() || now.After(crl.expires) { return false }
-    _, ok := crl.revoked[id]
-    return ok
+    e, ok := crl.revoked[id]
+    return ok && (e.until.IsZero() || !now.After(e.until))
 }
 
 func VerifyIBE(cfg GuardConfig, ibe IBE, apr APr, uia UIA, apa APA, tca TCA) error {
+    return VerifyIBEArgsContext(context.Background(), cfg, ibe, apr, uia, apa, tca, nil)
+}
+
+// VerifyIBEContext is VerifyIBE under ctx, which bounds the PDP call.
+func VerifyIBEContext(ctx context.Context, cfg GuardConfig, ibe IBE, apr APr, uia UIA, apa APA, tca TCA) error {
+    return VerifyIBEArgsContext(ctx, cfg, ibe, apr, uia, apa, tca, nil)
+}
+
+// VerifyIBEArgs is VerifyIBE for the args a step will actually be called
+// with once its ${steps...} references are filled in. args must match the
+// step's args (see MatchArgs) and the arg checks run on them. With nil args
+// the step's own args are used, and they must not contain references.
+func VerifyIBEArgs(cfg GuardConfig, ibe IBE, apr APr, uia UIA, apa APA, tca TCA, args map[string]any) error {
+    return VerifyIBEArgsContext(context.Background(), cfg, ibe, apr, uia, apa, tca, args)
+}
+
+// VerifyIBEArgsContext is VerifyIBEArgs under ctx: the PDP call ends with
+// ctx, so a caller that has gone away does not wait out the PDP timeout.
+func VerifyIBEArgsContext(ctx context.Context, cfg GuardConfig, ibe IBE, apr APr, uia UIA, apa APA, tca TCA, args map[string]any) error {
     now := time.Now()
     if now.After(ibe.Exp) { return errors.New("IBE-EXPIRED") }
     // simple replay cache by nonce
@@ -63,22 +136,27 @@ func VerifyIBE(cfg GuardConfig, ibe IBE, apr APr, uia UIA, apa APA, tca TCA) err
         aprForSig := apr; aprForSig.Proof = map[string]any{}
         if ok, _ := VerifyJWSObject(cfg.Secret, aprForSig, sig); !ok { return errors.New("APR-SIG-INVALID") }
     }
-    var cov, risk float64
-    switch cfg.VerifierMethod {
-    case "external-policy-v1":
-        cov, risk = VerifyAlignmentExternalPolicy(uia, apa, ExternalPolicy{Keywords: extractKeywords(strings.ToLower(uia.Purpose)), WriteRisk: 0.5})
-    case "classifier-v1":
-        cov, risk = VerifyAlignmentClassifier(uia, apa)
-    default:
-        cov, risk = VerifyAlignment(uia, apa)
+    // Always recompute with the verifier named by the APr, if the profile allows it
+    v, ok := LookupVerifier(apr.Method)
+    if !ok { return errors.New("ALIGN-METHOD-UNKNOWN") }
+    if !MethodAllowed(uia.PolicyProfile, apr.Method) { return errors.New("ALIGN-METHOD-NOT-ALLOWED") }
+    for _, c := range apr.Evidence.Components {
+        if !MethodAllowed(uia.PolicyProfile, c.Method) { return errors.New("ALIGN-METHOD-NOT-ALLOWED") }
     }
-    if apr.Method == "semantic-entailment-v1" {
-        // Require that evidence matches recomputed values within tolerance
-        if abs(apr.Evidence.Coverage-cov) > 1e-9 || abs(apr.Evidence.Risk-risk) > 1e-9 {
-            return errors.New("apr evidence mismatch")
-        }
+    var ev APrEvidence
+    // A verified APr proof lets expensive verifiers vouch for their own evidence
+    if t, ok := v.(SignedEvidenceTruster); ok && aprSigned(apr) && t.TrustSigned(apr.Evidence) {
+        ev = apr.Evidence
+    } else {
+        ev = v.Verify(uia, apa)
     }
-    if cov < cfg.MinAlignment { return errors.New("ALIGN-BELOW-THRESHOLD") }
+    if !evidenceMatches(apr.Evidence, ev) { return errors.New("ALIGN-MISMATCH") }
+    if len(ev.Denials) > 0 { return &PolicyDenyError{Reasons: ev.Denials} }
+    minAlign := cfg.Calibration.Threshold(uia.PolicyProfile, apr.Method, cfg.MinAlignment)
+    if ev.Coverage < minAlign { return errors.New("ALIGN-BELOW-THRESHOLD") }
+    minStep := minAlign
+    if t, ok := v.(StepThresholder); ok { minStep = t.StepThreshold() }
+    if se, ok := stepEvidence(ev, ibe.APAStepRef); ok && se.Score < minStep { return errors.New("ALIGN-STEP-BELOW-THRESHOLD") }
     // Revocation checks
     if isRevoked(uia.ID, now) { return errors.New("UIA-REVOKED") }
     if isRevoked(apa.ID, now) { return errors.New("APA-REVOKED") }
@@ -88,10 +166,31 @@ func VerifyIBE(cfg GuardConfig, ibe IBE, apr APr, uia UIA, apa APA, tca TCA) err
 	var step *APAStep
 	for i := range apa.Steps { if apa.Steps[i].ID == ibe.APAStepRef { step = &apa.Steps[i]; break } }
     if step == nil { return errors.New("IBE-STEP-NOT-FOUND") }
+    planned := *step
+    if err := ValidatePlan(apa); err != nil { return err }
+    if err := checkBranches(uia, apa, ev, minStep, step.ID); err != nil { return err }
+    call := *step
+    if args != nil {
+        if !MatchArgs(step.Args, args) { return errors.New("IBE-STEP-MISMATCH") }
+        call.Args = args
+    } else if HasStepRefs(step.Args) {
+        return ErrStepRefUnresolved
+    }
+    step = &call
+    // callers reserve the step's effects with Ledger.Reserve before invoking;
+    // this only fails fast when the budget is already spent or held
+    if err := cfg.Ledger.Check(uia, step.Expected.Writes); err != nil { return err }
+    if cfg.Injection != nil {
+        if f := cfg.Injection.ScanStep(*step); cfg.Injection.Blocked(f) { return &InjectionError{Findings: f} }
+    }
     for _, dc := range step.Expected.DataClasses { if !slices.Contains(uia.Constraints.DataClasses, dc) { return errors.New("DATA-CLASS-NOT-PERMITTED") } }
-    var op *TCAOperation
-	for i := range tca.Operations { if tca.Operations[i].Name == step.Tool { op = &tca.Operations[i]; break } }
-    if op == nil { return errors.New("TCA-OP-NOT-ALLOWED") }
+    if cfg.Tools != nil {
+        t, ok := cfg.Tools.LookupTCA(ibe.TCARef)
+        if !ok { return errors.New("TCA-UNKNOWN") }
+        tca = t
+    }
+    op, ok := tcaOperation(tca, step.Tool)
+    if !ok { return errors.New("TCA-OP-NOT-ALLOWED") }
     // Verify TCA operator proof if present
     if sig, _ := tca.Proof["jws"].(string); sig != "" {
         t := tca
@@ -99,23 +198,94 @@ func VerifyIBE(cfg GuardConfig, ibe IBE, apr APr, uia UIA, apa APA, tca TCA) err
         if ok, _ := VerifyJWSObject(cfg.Secret, t, sig); !ok { return errors.New("TCA-SIG-INVALID") }
     }
     if step.Expected.Writes > op.Effects.Writes { return errors.New("TCA-EFFECTS-EXCEEDED") }
-    // Optional destination membrane check
-    if len(op.Effects.Destinations) > 0 {
-        // naive destination extraction from url arg
-        if u, ok := step.Args["url"].(string); ok {
-            allowed := false
-            for _, d := range op.Effects.Destinations { if strings.Contains(u, d) { allowed = true; break } }
-            if !allowed { return errors.New("DESTINATION-NOT-ALLOWED") }
+    // Stepwise consent for elevated steps under high-risk intents
+    if cfg.ConsentLevel > 0 && uia.RiskBudget.Level >= cfg.ConsentLevel && stepElevated(cfg, *step, *op) {
+        if cfg.Consent == nil { return errors.New("AUTHZ-NEED-CONSENT") }
+        // consent covers the step as planned in this APA, not the same step id elsewhere
+        tok, ok := cfg.Consent(uia.ID, apa.ID, step.ID)
+        if !ok || tok.UIARef != uia.ID || tok.APARef != apa.ID || tok.StepRef != step.ID || tok.ArgsHash != ConsentArgsHash(planned.Args) { return errors.New("AUTHZ-NEED-CONSENT") }
+        if err := VerifyConsent(cfg.Secret, cfg.ApproverSecret, tok, now); err != nil { return err }
+    }
+    if err := checkStepArgs(cfg, *op, *step, uia); err != nil { return err }
+    // External policy decision point; an unreachable PDP blocks the call
+    if cfg.PDP != nil {
+        d, err := cfg.PDP.Decide(ctx, PDPInput{UIA: uia, APA: apa, Step: *step, TCA: tca, IBE: ibe})
+        if err != nil { return errors.New("SYS-RETRY") }
+        if !d.Allow { return &PolicyDenyError{Reasons: d.Reasons} }
+    }
+	return nil
+}
+
+// checkStepArgs holds the guard checks that depend on the step's args.
+func checkStepArgs(cfg GuardConfig, op TCAOperation, step APAStep, uia UIA) error {
+    // Optional destination membrane check; tools re-check redirect hops
+    for _, d := range argDestinations(cfg.Tools, step) {
+        if !DestinationAllowed(op.Effects.Destinations, d) { return errors.New("DESTINATION-NOT-ALLOWED") }
+    }
+    if err := validateArgs(cfg.Tools, step); err != nil { return err }
+    if op.ArgsSchema != nil && ValidateSchema(op.ArgsSchema, step.Args) != nil { return errors.New("INPUT-SCHEMA-INVALID") }
+    // Subprocess steps must stay within the attested commands and argument patterns
+    if op.Effects.Exec != nil {
+        if _, _, err := op.Effects.Exec.CheckArgs(step.Args); err != nil { return errors.New("INPUT-SCHEMA-INVALID") }
+    }
+    return checkArgLabels(cfg.Tools, step, uia)
+}
+
+// CheckRefs requires the artifacts presented with an IBE to be the ones it
+// and each other reference. Callers that receive all four from an untrusted
+// client (e.g. over MCP) check this before VerifyIBE.
+func CheckRefs(ibe IBE, uia UIA, apa APA, apr APr) error {
+    if ibe.UIARef != uia.ID || ibe.APrRef != apr.ID || apr.UIA != uia.ID || apr.APA != apa.ID || apa.UIA != uia.ID {
+        return errors.New("IBE-REF-MISMATCH")
+    }
+    return nil
+}
+
+// validateArgs uses the registered tool's ArgValidator, falling back to the
+// built-in checks for http.get and ollama.generate.
+func validateArgs(tools *ToolRegistry, step APAStep) error {
+    if t, ok := tools.Lookup(step.Tool); ok {
+        if v, ok := t.(ArgValidator); ok {
+            if v.ValidateArgs(step.Args) != nil { return errors.New("INPUT-SCHEMA-INVALID") }
+            return nil
         }
     }
-    // Basic arg validation by tool name (placeholder for JSON Schema)
-    if step.Tool == "http.get" {
-        if u, ok := step.Args["url"].(string); !ok || !(strings.HasPrefix(u, "http://") || strings.HasPrefix(u, "https://")) { return errors.New("INPUT-SCHEMA-INVALID") }
+    var v ArgValidator
+    switch step.Tool {
+    case "http.get":
+        v = &HTTPTool{}
+    case "ollama.generate":
+        v = GenerateTool{}
+    default:
+        return nil
     }
-    if step.Tool == "ollama.generate" {
-        if p, ok := step.Args["prompt"].(string); !ok || len(p) == 0 { return errors.New("INPUT-SCHEMA-INVALID") }
+    if v.ValidateArgs(step.Args) != nil { return errors.New("INPUT-SCHEMA-INVALID") }
+    return nil
+}
+
+// argDestinations lists the destinations a step's args name: the registered
+// tool's DestinationArgs, else the "url" arg.
+func argDestinations(tools *ToolRegistry, step APAStep) []string {
+    if t, ok := tools.Lookup(step.Tool); ok {
+        if d, ok := t.(DestinationArgs); ok { return d.ArgDestinations(step.Args) }
     }
-	return nil
+    if u, ok := step.Args["url"].(string); ok { return []string{u} }
+    return nil
+}
+
+// checkArgLabels requires the labels of the data a step selects to be
+// permitted by the UIA. Paths outside the tool's scope are PATH-NOT-ALLOWED;
+// args that cannot be labelled fail closed.
+func checkArgLabels(tools *ToolRegistry, step APAStep, uia UIA) error {
+    t, ok := tools.Lookup(step.Tool)
+    if !ok { return nil }
+    l, ok := t.(ArgLabeler)
+    if !ok { return nil }
+    labels, err := l.LabelArgs(step.Args)
+    if errors.Is(err, ErrPathNotAllowed) { return ErrPathNotAllowed }
+    if err != nil { return errors.New("INPUT-SCHEMA-INVALID") }
+    for _, dc := range labels { if !slices.Contains(uia.Constraints.DataClasses, dc) { return errors.New("DATA-CLASS-NOT-PERMITTED") } }
+    return nil
 }
 
 // VerifyAlignment computes deterministic coverage and risk for APA against UIA.
@@ -131,13 +301,60 @@ func VerifyAlignment(uia UIA, apa APA) (coverage float64, risk float64) {
         if stepEntailsPurpose(s, entailKeywords) { aligned++ }
     }
     coverage = float64(aligned) / float64(total)
-    risk = 0
+    risk = planRisk(uia, apa)
+    return
+}
+
+// planRisk is the semantic-entailment-v1 risk: +0.5 for predicted writes,
+// +0.3 if the purpose suggests outbound actions, clamped to [0,1].
+func planRisk(uia UIA, apa APA) float64 {
+    purpose := strings.ToLower(uia.Purpose)
+    risk := 0.0
     if apa.Totals.PredictedWrites > 0 { risk += 0.5 }
     writey := []string{"send","post","write","export","email","delete"}
     for _, w := range writey { if strings.Contains(purpose, w) { risk += 0.3; break } }
     if risk > 1 { risk = 1 }
     if risk < 0 { risk = 0 }
-    return
+    return risk
+}
+
+// semanticStepEvidence explains the semantic-entailment-v1 result per step.
+func semanticStepEvidence(uia UIA, apa APA) []StepEvidence {
+    terms := extractKeywords(strings.ToLower(uia.Purpose))
+    out := make([]StepEvidence, 0, len(apa.Steps))
+    for _, s := range apa.Steps {
+        se := StepEvidence{Step: s.ID, Matched: matchedTerms(stepText(s), terms)}
+        if stepEntailsPurpose(s, terms) { se.Score = 1 }
+        switch {
+        case se.Score == 1 && len(se.Matched) == 0:
+            se.Reason = "no purpose terms to match"
+        case se.Score == 1:
+            se.Reason = "mentions purpose terms"
+        case s.Tool != "ollama.generate" && s.Tool != "http.get":
+            se.Reason = "tool not covered by method"
+        default:
+            se.Reason = "no purpose term mentioned"
+        }
+        out = append(out, se)
+    }
+    return out
+}
+
+// stepText is the lowercased prompt or url a keyword verifier inspects.
+func stepText(s APAStep) string {
+    var text string
+    if s.Tool == "ollama.generate" {
+        text, _ = s.Args["prompt"].(string)
+    } else if s.Tool == "http.get" {
+        text, _ = s.Args["url"].(string)
+    }
+    return strings.ToLower(text)
+}
+
+func matchedTerms(s string, terms []string) []string {
+    var out []string
+    for _, t := range terms { if strings.Contains(s, t) { out = append(out, t) } }
+    return out
 }
 
 func stepEntailsPurpose(s APAStep, purposeTerms []string) bool {
@@ -176,6 +393,18 @@ func containsAny(s string, terms []string) bool {
     return false
 }
 
+// aprSigned reports whether the APr carries a proof; VerifyIBE checks it
+// before alignment is evaluated.
+func aprSigned(apr APr) bool {
+    sig, _ := apr.Proof["jws"].(string)
+    return sig != ""
+}
+
+func stepEvidence(ev APrEvidence, stepID string) (StepEvidence, bool) {
+    for _, se := range ev.Steps { if se.Step == stepID { return se, true } }
+    return StepEvidence{}, false
+}
+
 func abs(f float64) float64 { if f < 0 { return -f }; return f }
 
 
@@ -1,22 +1,242 @@
 package ais
 
 import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
     "errors"
+    "fmt"
     "io"
+    "mime"
     "net/http"
+    "net/url"
+    "path"
+    "strings"
+    "time"
 )
 
-// Simple HTTP GET tool
-type HTTPTool struct { HTTP *http.Client }
+// HTTP tool defaults.
+const (
+    DefaultHTTPTimeout      = 10 * time.Second
+    DefaultHTTPMaxBytes     = 2000
+    DefaultHTTPMaxRedirects = 5
+)
+
+// DefaultHTTPContentTypes are the media types http.get accepts when
+// ContentTypes is empty. Entries ending in "/" match a whole type.
+var DefaultHTTPContentTypes = []string{"text/", "application/json", "application/xml", "application/xhtml+xml"}
+
+var (
+    // ErrDestinationNotAllowed is returned when the URL or a redirect hop
+    // leaves the TCA's declared destinations.
+    ErrDestinationNotAllowed = errors.New("DESTINATION-NOT-ALLOWED")
+    // ErrRedirectRefused is returned for redirects under no-followup-http.
+    ErrRedirectRefused = errors.New("TOOL-REDIRECT-REFUSED")
+    // ErrContentTypeNotAllowed is returned for responses outside ContentTypes.
+    ErrContentTypeNotAllowed = errors.New("TOOL-CONTENT-TYPE-NOT-ALLOWED")
+)
+
+// HTTPStatusError reports a non-200 response.
+type HTTPStatusError struct {
+    Status   int
+    Location string // redirect target, for 3xx
+}
+
+func (e *HTTPStatusError) Error() string {
+    if e.Location != "" { return fmt.Sprintf("http.get: status %d redirect to %s", e.Status, e.Location) }
+    return fmt.Sprintf("http.get: status %d %s", e.Status, http.StatusText(e.Status))
+}
+
+// HTTPResult is a fetched response. Body is cut at MaxBytes on a UTF-8
+// boundary; BodyHash covers the returned Body.
+type HTTPResult struct {
+    URL       string            `json:"url"`
+    Status    int               `json:"status"`
+    Headers   map[string]string `json:"headers,omitempty"`
+    Body      string            `json:"-"`
+    BodyHash  string            `json:"bodyHash"`
+    Truncated bool              `json:"truncated,omitempty"`
+    Redirects []string          `json:"redirects,omitempty"`
+}
+
+// resultHeaders is the subset of response headers kept in HTTPResult.
+var resultHeaders = []string{"Content-Type", "Content-Length", "Content-Language", "Last-Modified", "ETag"}
+
+// HTTPTool is http.get. Destinations, when set, are declared in its TCA and
+// re-checked on every redirect hop; NoRedirects (or the no-followup-http
+// obligation) refuses redirects altogether. Zero limits use the defaults.
+type HTTPTool struct {
+    HTTP         *http.Client
+    NoRedirects  bool
+    Timeout      time.Duration
+    MaxBytes     int64
+    MaxRedirects int
+    ContentTypes []string
+    Destinations []string
+}
+
+func (h *HTTPTool) Name() string { return "http.get" }
+
+func (h *HTTPTool) TCA() TCA {
+    return TCA{ID: "urn:tca:http.get@1", Operator: "local", Operations: []TCAOperation{{Name: "http.get", Effects: OperationEffects{Writes: 0, DataClasses: []string{"derived"}, Destinations: h.Destinations}}}}
+}
+
+func (h *HTTPTool) InputSchema() map[string]any {
+    return map[string]any{"type": "object", "properties": map[string]any{"url": map[string]any{"type": "string", "format": "uri", "pattern": "^https?://"}}, "required": []string{"url"}}
+}
+
+func (h *HTTPTool) ValidateArgs(args map[string]any) error {
+    u, ok := args["url"].(string)
+    if !ok || !(strings.HasPrefix(u, "http://") || strings.HasPrefix(u, "https://")) { return errors.New("url must be an http(s) URL") }
+    return nil
+}
+
+// Invoke fetches args["url"]. Redirects are refused when the context carries
+// the no-followup-http obligation.
+func (h *HTTPTool) Invoke(ctx context.Context, args map[string]any) (Result, error) {
+    if err := h.ValidateArgs(args); err != nil { return Result{}, err }
+    t := *h
+    if HasObligation(ObligationsFrom(ctx), ObligationNoFollowupHTTP) { t.NoRedirects = true }
+    res, err := t.Fetch(ctx, args["url"].(string))
+    if err != nil { return Result{}, err }
+    meta := map[string]any{"url": res.URL, "status": res.Status, "headers": res.Headers, "bodyHash": res.BodyHash, "truncated": res.Truncated}
+    if len(res.Redirects) > 0 { meta["redirects"] = res.Redirects }
+    return Result{Output: res.Body, Meta: meta}, nil
+}
 
+// Get fetches url without a caller context and returns the body.
 func (h *HTTPTool) Get(url string) (string, error) {
-    resp, err := h.HTTP.Get(url)
+    res, err := h.Fetch(context.Background(), url)
     if err != nil { return "", err }
+    return res.Body, nil
+}
+
+// Fetch performs the GET, enforcing the timeout, redirect policy, content
+// types and byte cap.
+func (h *HTTPTool) Fetch(ctx context.Context, rawURL string) (HTTPResult, error) {
+    if !DestinationAllowed(h.Destinations, rawURL) { return HTTPResult{}, fmt.Errorf("%w: %s", ErrDestinationNotAllowed, rawURL) }
+    timeout := h.Timeout
+    if timeout <= 0 { timeout = DefaultHTTPTimeout }
+    ctx, cancel := context.WithTimeout(ctx, timeout)
+    defer cancel()
+
+    var hops []string
+    client := http.Client{}
+    if h.HTTP != nil { client = *h.HTTP }
+    client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+        if h.NoRedirects { return fmt.Errorf("%w: %s", ErrRedirectRefused, req.URL) }
+        maxHops := h.MaxRedirects
+        if maxHops <= 0 { maxHops = DefaultHTTPMaxRedirects }
+        if len(via) > maxHops { return fmt.Errorf("http.get: more than %d redirects", maxHops) }
+        if req.URL.Scheme != "http" && req.URL.Scheme != "https" { return fmt.Errorf("%w: %s", ErrDestinationNotAllowed, req.URL) }
+        if !DestinationAllowed(h.Destinations, req.URL.String()) { return fmt.Errorf("%w: redirect to %s", ErrDestinationNotAllowed, req.URL) }
+        hops = append(hops, req.URL.String())
+        return nil
+    }
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+    if err != nil { return HTTPResult{}, err }
+    resp, err := client.Do(req)
+    if err != nil { return HTTPResult{}, err }
     defer resp.Body.Close()
-    if resp.StatusCode != 200 { return "", errors.New("non-200 from http.get") }
-    b, _ := io.ReadAll(resp.Body)
-    if len(b) > 2000 { b = b[:2000] }
-    return string(b), nil
+    if resp.StatusCode != http.StatusOK { return HTTPResult{}, &HTTPStatusError{Status: resp.StatusCode, Location: resp.Header.Get("Location")} }
+    if ct := resp.Header.Get("Content-Type"); !contentTypeAllowed(h.ContentTypes, ct) {
+        return HTTPResult{}, fmt.Errorf("%w: %q", ErrContentTypeNotAllowed, ct)
+    }
+
+    maxBytes := h.MaxBytes
+    if maxBytes <= 0 { maxBytes = DefaultHTTPMaxBytes }
+    // read one byte past the cap so truncation is detected without buffering the rest
+    b, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+    if err != nil { return HTTPResult{}, fmt.Errorf("http.get: reading body: %w", err) }
+    res := HTTPResult{URL: resp.Request.URL.String(), Status: resp.StatusCode, Headers: map[string]string{}, Redirects: hops}
+    body := string(b)
+    if int64(len(b)) > maxBytes {
+        body, res.Truncated = truncateUTF8(body, int(maxBytes)), true
+    }
+    res.Body = body
+    sum := sha256.Sum256([]byte(body))
+    res.BodyHash = "sha256:" + hex.EncodeToString(sum[:])
+    for _, k := range resultHeaders {
+        if v := resp.Header.Get(k); v != "" { res.Headers[k] = v }
+    }
+    return res, nil
 }
 
+// DestinationAllowed reports whether rawURL is within dests. An entry with a
+// scheme ("https://api.example.com/v1") needs the same scheme, host and port
+// (a missing port is the scheme's default) and a path equal to the entry's or
+// below it ("/v1/..."), compared segment by segment after decoding; paths with
+// "." or ".." segments or empty segments never match. A bare entry
+// ("example.com") matches that host and its subdomains, or for "mailto:"
+// URLs the recipient's domain. URLs carrying userinfo are refused. No entries
+// allow all.
+func DestinationAllowed(dests []string, rawURL string) bool {
+    if len(dests) == 0 { return true }
+    u, err := url.Parse(rawURL)
+    if err != nil || u.User != nil { return false }
+    host := strings.ToLower(u.Hostname())
+    if u.Scheme == "mailto" {
+        _, domain, ok := strings.Cut(u.Opaque, "@")
+        if !ok { return false }
+        host = strings.ToLower(domain)
+    }
+    if host == "" { return false }
+    for _, d := range dests {
+        if strings.Contains(d, "://") {
+            if urlWithin(d, u) { return true }
+            continue
+        }
+        d = strings.ToLower(d)
+        if host == d || strings.HasSuffix(host, "."+d) { return true }
+    }
+    return false
+}
+
+// urlWithin matches u against a URL entry: scheme and host compare
+// case-folded, ports after filling in the scheme's default, and the entry's
+// path segments must be a prefix of u's.
+func urlWithin(entry string, u *url.URL) bool {
+    e, err := url.Parse(entry)
+    if err != nil || !strings.EqualFold(e.Scheme, u.Scheme) || !strings.EqualFold(e.Hostname(), u.Hostname()) { return false }
+    if urlPort(e) != urlPort(u) { return false }
+    base, ok := pathSegments(e.Path)
+    if !ok { return false }
+    segs, ok := pathSegments(u.Path)
+    if !ok || len(segs) < len(base) { return false }
+    for i := range base { if segs[i] != base[i] { return false } }
+    return true
+}
+
+// urlPort is u's port, or 443 / 80 for https / http without one.
+func urlPort(u *url.URL) string {
+    if p := u.Port(); p != "" { return p }
+    switch strings.ToLower(u.Scheme) {
+    case "https":
+        return "443"
+    case "http":
+        return "80"
+    }
+    return ""
+}
+
+// pathSegments splits a decoded URL path into its segments. A trailing slash
+// is ignored; a path that path.Clean would change (dot segments, "//") is
+// refused.
+func pathSegments(p string) ([]string, bool) {
+    if p == "" || p == "/" { return nil, true }
+    if !strings.HasPrefix(p, "/") { return nil, false }
+    p = strings.TrimSuffix(p, "/")
+    if path.Clean(p) != p { return nil, false }
+    return strings.Split(p[1:], "/"), true
+}
 
+func contentTypeAllowed(allowed []string, header string) bool {
+    if len(allowed) == 0 { allowed = DefaultHTTPContentTypes }
+    mt, _, err := mime.ParseMediaType(header)
+    if err != nil { return false }
+    for _, a := range allowed {
+        a = strings.ToLower(a)
+        if strings.HasSuffix(a, "/") && strings.HasPrefix(mt, a) || mt == a { return true }
+    }
+    return false
+}
@@ -0,0 +1,209 @@
+package ais
+
+import (
+    "encoding/base64"
+    "encoding/json"
+    "fmt"
+    "os"
+    "regexp"
+    "sort"
+    "strings"
+    "unicode/utf8"
+)
+
+// Injection rule kinds.
+const (
+    InjectionRegex         = "regex"
+    InjectionHiddenUnicode = "hidden-unicode"
+    InjectionBase64        = "base64"
+)
+
+// InjectionRule is one prompt-injection detector. A match either denies
+// outright or adds Risk to the scanned text's total.
+type InjectionRule struct {
+    ID      string  `json:"id"`
+    Kind    string  `json:"kind"`
+    Pattern string  `json:"pattern,omitempty"` // regex: RE2 pattern
+    MinLen  int     `json:"minLen,omitempty"`  // base64: shortest run considered (default 40)
+    Risk    float64 `json:"risk,omitempty"`
+    Deny    bool    `json:"deny,omitempty"`
+
+    re *regexp.Regexp
+}
+
+// InjectionFinding is one rule match in a scanned field.
+type InjectionFinding struct {
+    Rule  string  `json:"rule"`
+    Field string  `json:"field"`
+    Match string  `json:"match"`
+    Risk  float64 `json:"risk,omitempty"`
+    Deny  bool    `json:"deny,omitempty"`
+}
+
+// InjectionError is INPUT-PROMPT-INJECTION with the findings that caused it.
+type InjectionError struct{ Findings []InjectionFinding }
+
+func (e *InjectionError) Error() string { return "INPUT-PROMPT-INJECTION" }
+
+// InjectionScanner scans step args and fetched content. Text is rejected when
+// a deny rule matches or the summed risk of its findings reaches DenyAt.
+// Base64 runs are decoded and the decoded text is scanned as well.
+type InjectionScanner struct {
+    Rules  []InjectionRule `json:"rules"`
+    DenyAt float64         `json:"denyAt"`
+}
+
+// DefaultInjectionScanner returns the built-in rules: instruction overrides,
+// role spoofing and hidden Unicode deny; weaker signals add risk.
+func DefaultInjectionScanner() *InjectionScanner {
+    s := &InjectionScanner{DenyAt: 1, Rules: []InjectionRule{
+        {ID: "override", Kind: InjectionRegex, Deny: true, Pattern: `(?i)\b(ignore|disregard|forget|override|bypass)\b[^.\n]{0,40}\b(previous|prior|above|earlier|preceding|all|any|system|safety)\b[^.\n]{0,30}\b(instructions?|prompts?|rules|directives|guidelines|context|polic(y|ies))\b`},
+        {ID: "role-spoofing", Kind: InjectionRegex, Deny: true, Pattern: `(?im)(^\s*(system|developer)\s*:|<\|?(im_start|im_end|system|endoftext)\|?>|\[/?INST\]|<</?SYS>>|^\s*#{2,}\s*(system|instruction)s?\b)`},
+        {ID: "persona-switch", Kind: InjectionRegex, Risk: 0.5, Pattern: `(?i)\b(you are now|from now on,? you|act as (an? )?(unrestricted|jailbroken|dan)|developer mode|jailbreak)\b`},
+        {ID: "new-instructions", Kind: InjectionRegex, Risk: 0.5, Pattern: `(?i)\b(new|updated|real|actual|hidden)\s+(instructions?|task|objective)\s*:`},
+        {ID: "exfiltration", Kind: InjectionRegex, Risk: 0.5, Pattern: `(?i)\b(send|post|upload|forward|exfiltrate|leak)\b[^.\n]{0,40}\b(passwords?|secrets?|api[ _-]?keys?|tokens?|credentials|system prompt)\b`},
+        {ID: "hidden-unicode", Kind: InjectionHiddenUnicode, Deny: true},
+        {ID: "base64-blob", Kind: InjectionBase64, Risk: 0.5, MinLen: 40},
+    }}
+    if err := s.Compile(); err != nil { panic(err) }
+    return s
+}
+
+// LoadInjectionScanner reads a scanner config {denyAt, rules}.
+func LoadInjectionScanner(path string) (*InjectionScanner, error) {
+    b, err := os.ReadFile(path)
+    if err != nil { return nil, err }
+    s := &InjectionScanner{}
+    if err := json.Unmarshal(b, s); err != nil { return nil, fmt.Errorf("%s: %w", path, err) }
+    if s.DenyAt <= 0 { s.DenyAt = 1 }
+    if err := s.Compile(); err != nil { return nil, fmt.Errorf("%s: %w", path, err) }
+    return s, nil
+}
+
+// Compile validates the rules and compiles regex patterns.
+func (s *InjectionScanner) Compile() error {
+    for i := range s.Rules {
+        r := &s.Rules[i]
+        switch r.Kind {
+        case InjectionRegex:
+            re, err := regexp.Compile(r.Pattern)
+            if err != nil { return fmt.Errorf("injection rule %s: %w", r.ID, err) }
+            r.re = re
+        case InjectionHiddenUnicode, InjectionBase64:
+        default:
+            return fmt.Errorf("injection rule %s: unknown kind %q", r.ID, r.Kind)
+        }
+    }
+    return nil
+}
+
+// ScanStep scans every string in the step's args; fields are named by path.
+func (s *InjectionScanner) ScanStep(step APAStep) []InjectionFinding {
+    var out []InjectionFinding
+    keys := make([]string, 0, len(step.Args))
+    for k := range step.Args { keys = append(keys, k) }
+    sort.Strings(keys)
+    for _, k := range keys { out = append(out, s.scanValue("args."+k, step.Args[k])...) }
+    return out
+}
+
+func (s *InjectionScanner) scanValue(field string, v any) []InjectionFinding {
+    switch x := v.(type) {
+    case string:
+        return s.Scan(field, x)
+    case []any:
+        var out []InjectionFinding
+        for i, e := range x { out = append(out, s.scanValue(fmt.Sprintf("%s[%d]", field, i), e)...) }
+        return out
+    case map[string]any:
+        keys := make([]string, 0, len(x))
+        for k := range x { keys = append(keys, k) }
+        sort.Strings(keys)
+        var out []InjectionFinding
+        for _, k := range keys { out = append(out, s.scanValue(field+"."+k, x[k])...) }
+        return out
+    }
+    return nil
+}
+
+// Scan runs every rule over text.
+func (s *InjectionScanner) Scan(field, text string) []InjectionFinding {
+    return s.scan(field, text, 0)
+}
+
+func (s *InjectionScanner) scan(field, text string, depth int) []InjectionFinding {
+    var out []InjectionFinding
+    for _, r := range s.Rules {
+        f := InjectionFinding{Rule: r.ID, Field: field, Risk: r.Risk, Deny: r.Deny}
+        switch r.Kind {
+        case InjectionRegex:
+            if m := r.re.FindString(text); m != "" { f.Match = clip(m); out = append(out, f) }
+        case InjectionHiddenUnicode:
+            if m := hiddenRunes(text); m != "" { f.Match = m; out = append(out, f) }
+        case InjectionBase64:
+            minLen := r.MinLen
+            if minLen <= 0 { minLen = 40 }
+            // the rule reports once; every decodable blob is scanned, up to
+            // maxBase64ScanBytes of blobs per text
+            budget := maxBase64ScanBytes
+            for _, blob := range base64Run.FindAllString(text, -1) {
+                if len(blob) < minLen { continue }
+                if budget -= len(blob); budget < 0 { break }
+                dec, ok := decodeBase64Text(blob)
+                if !ok { continue }
+                if f.Match == "" { f.Match = clip(blob); out = append(out, f) }
+                // payloads hidden in base64 are scanned too, one level deep
+                if depth == 0 { out = append(out, s.scan(field+"(base64)", dec, depth+1)...) }
+            }
+        }
+    }
+    return out
+}
+
+// Blocked reports whether findings deny: any deny rule, or summed risk >= DenyAt.
+func (s *InjectionScanner) Blocked(findings []InjectionFinding) bool {
+    risk := 0.0
+    for _, f := range findings {
+        if f.Deny { return true }
+        risk += f.Risk
+    }
+    return s.DenyAt > 0 && risk >= s.DenyAt-1e-9
+}
+
+// maxBase64ScanBytes bounds the base64 blobs decoded per scanned text.
+const maxBase64ScanBytes = 64 << 10
+
+var base64Run = regexp.MustCompile(`[A-Za-z0-9+/_-]{16,}={0,2}`)
+
+// decodeBase64Text decodes standard or URL-safe base64 that yields mostly
+// printable UTF-8, so long hex ids and hashes are not reported.
+func decodeBase64Text(blob string) (string, bool) {
+    for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+        b, err := enc.DecodeString(blob)
+        if err != nil || !utf8.Valid(b) { continue }
+        printable := 0
+        for _, r := range string(b) { if r == '\n' || r == '\t' || r >= ' ' && r != 0x7f { printable++ } }
+        if printable*10 >= utf8.RuneCount(b)*9 { return string(b), true }
+    }
+    return "", false
+}
+
+// hiddenRunes lists zero-width, bidi-control and tag characters found in text.
+func hiddenRunes(text string) string {
+    var found []string
+    seen := map[rune]bool{}
+    for _, r := range text {
+        hidden := r >= 0x200B && r <= 0x200F || r >= 0x202A && r <= 0x202E || r >= 0x2060 && r <= 0x2064 ||
+            r >= 0x2066 && r <= 0x2069 || r == 0xFEFF || r == 0x00AD || r >= 0xE0000 && r <= 0xE007F
+        if hidden && !seen[r] {
+            seen[r] = true
+            found = append(found, fmt.Sprintf("U+%04X", r))
+        }
+    }
+    return strings.Join(found, ",")
+}
+
+func clip(s string) string {
+    if len(s) <= 80 { return s }
+    return truncateUTF8(s, 77) + "..."
+}
@@ -0,0 +1,128 @@
+package ais
+
+import (
+    "errors"
+    "sync"
+)
+
+// Usage is what a UIA has actually spent: writes performed and records
+// returned by its tool calls.
+type Usage struct {
+    Writes  int `json:"writes"`
+    Records int `json:"records"`
+}
+
+// Ledger accumulates actual Usage per UIA. The guard adds it to a step's
+// expected effects when checking the UIA's risk budget, so a plan cannot
+// exceed its budget across calls. Callers reserve a step's effects before
+// invoking its tool and settle the reservation with the result, so
+// concurrent calls of one UIA cannot all pass the check on the same spend.
+type Ledger struct {
+    mu   sync.Mutex
+    m    map[string]Usage
+    held map[string]Usage
+}
+
+func NewLedger() *Ledger { return &Ledger{m: map[string]Usage{}, held: map[string]Usage{}} }
+
+// Usage returns what uiaRef has spent so far.
+func (l *Ledger) Usage(uiaRef string) Usage {
+    if l == nil { return Usage{} }
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    return l.m[uiaRef]
+}
+
+// Record charges a tool result to uiaRef and returns the new total.
+func (l *Ledger) Record(uiaRef string, r Result) Usage {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    return l.recordLocked(uiaRef, r)
+}
+
+func (l *Ledger) recordLocked(uiaRef string, r Result) Usage {
+    if l.m == nil { l.m = map[string]Usage{} }
+    u := l.m[uiaRef]
+    u.Writes += r.Writes
+    u.Records += r.Records
+    l.m[uiaRef] = u
+    return u
+}
+
+// Check reports whether a step expecting writes still fits the UIA's budget
+// given the writes it has spent and other calls hold, and whether it has
+// records left, without reserving anything.
+func (l *Ledger) Check(uia UIA, writes int) error {
+    if l == nil { return nil }
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    return l.checkLocked(uia, writes)
+}
+
+func (l *Ledger) checkLocked(uia UIA, writes int) error {
+    spent, held := l.m[uia.ID], l.held[uia.ID]
+    if spent.Writes+held.Writes+writes > uia.RiskBudget.MaxWrites { return errors.New("RISK-WRITES-EXCEEDED") }
+    if spent.Records > 0 && spent.Records >= uia.RiskBudget.MaxRecords { return errors.New("RISK-RECORDS-EXCEEDED") }
+    return nil
+}
+
+// Reservation holds a step's expected writes and the UIA's remaining records
+// between the budget check and the tool call. Settle charges the result the
+// tool returned, with or without an error, and Release drops the hold when
+// the tool did not run.
+type Reservation struct {
+    l      *Ledger
+    uiaRef string
+    held   Usage
+    done   bool
+}
+
+// Reserve atomically checks a step expecting writes against the UIA's budget,
+// as Check does, and holds the writes along with the records no other call
+// holds, so concurrent calls of the same UIA never get more writes or records
+// between them than the budget has left. A call that finds every record held
+// gets a record limit of 0. A nil Ledger reserves nothing and leaves the
+// whole record budget to the call.
+func (l *Ledger) Reserve(uia UIA, writes int) (*Reservation, error) {
+    if l == nil { return &Reservation{uiaRef: uia.ID, held: Usage{Records: uia.RiskBudget.MaxRecords}}, nil }
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    if err := l.checkLocked(uia, writes); err != nil { return nil, err }
+    spent, held := l.m[uia.ID], l.held[uia.ID]
+    r := &Reservation{l: l, uiaRef: uia.ID, held: Usage{Writes: writes, Records: max(uia.RiskBudget.MaxRecords-spent.Records-held.Records, 0)}}
+    if l.held == nil { l.held = map[string]Usage{} }
+    l.held[uia.ID] = Usage{Writes: held.Writes + r.held.Writes, Records: held.Records + r.held.Records}
+    return r, nil
+}
+
+// Records is the record limit the reserved call may return; pass it to
+// WithRecordLimit.
+func (r *Reservation) Records() int { return r.held.Records }
+
+// Settle charges the tool result to the UIA in place of the hold and returns
+// the new total. Settling or releasing again does nothing.
+func (r *Reservation) Settle(res Result) Usage {
+    if r.l == nil { return Usage{} }
+    r.l.mu.Lock()
+    defer r.l.mu.Unlock()
+    if r.done { return r.l.m[r.uiaRef] }
+    r.releaseLocked()
+    return r.l.recordLocked(r.uiaRef, res)
+}
+
+// Release drops the hold without charging anything.
+func (r *Reservation) Release() {
+    if r.l == nil { return }
+    r.l.mu.Lock()
+    defer r.l.mu.Unlock()
+    if !r.done { r.releaseLocked() }
+}
+
+func (r *Reservation) releaseLocked() {
+    r.done = true
+    h := r.l.held[r.uiaRef]
+    h.Writes -= r.held.Writes
+    h.Records -= r.held.Records
+    if h == (Usage{}) { delete(r.l.held, r.uiaRef); return }
+    r.l.held[r.uiaRef] = h
+}
@@ -0,0 +1,90 @@
+package ais
+
+import (
+    "regexp"
+    "slices"
+    "strconv"
+    "strings"
+    "unicode/utf8"
+)
+
+// Obligations are constraints an APr places on the executor of the plan.
+const (
+    // ObligationRedactPII masks personal data in tool output.
+    ObligationRedactPII = "redact-pii"
+    // ObligationMaxBytes caps tool output; the full form is "max-bytes:<n>".
+    ObligationMaxBytes = "max-bytes:"
+    // ObligationNoFollowupHTTP forbids HTTP requests beyond the planned URLs,
+    // including redirects.
+    ObligationNoFollowupHTTP = "no-followup-http"
+)
+
+// DeriveObligations computes the default obligations shared by the built-in
+// verifiers. Fetched content is the untrusted input, so obligations only apply
+// to plans with http.get steps:
+//   - max-bytes:2000 on tool output;
+//   - redact-pii unless the UIA permits the "pii" data class;
+//   - no-followup-http when the plan already uses the whole external-call budget
+//     (see ExternalCalls).
+func DeriveObligations(uia UIA, apa APA) []string {
+    if !slices.ContainsFunc(apa.Steps, func(s APAStep) bool { return s.Tool == "http.get" }) { return nil }
+    out := []string{ObligationMaxBytes + "2000"}
+    if !slices.Contains(uia.Constraints.DataClasses, "pii") { out = append(out, ObligationRedactPII) }
+    if uia.RiskBudget.MaxExternalCalls <= ExternalCalls(apa) { out = append(out, ObligationNoFollowupHTTP) }
+    slices.Sort(out)
+    return out
+}
+
+// ExternalCall reports whether a step of the named tool reaches beyond the
+// host: http.get and email.send do, whether or not their TCA restricts the
+// destinations. Planned steps count against the UIA's maxExternalCalls.
+func ExternalCall(tool string) bool { return tool == "http.get" || tool == "email.send" }
+
+// ExternalCalls counts the external calls among the plan's steps.
+func ExternalCalls(apa APA) int {
+    n := 0
+    for _, s := range apa.Steps { if ExternalCall(s.Tool) { n++ } }
+    return n
+}
+
+// HasObligation reports whether name (or a "name:<arg>" form) is present.
+func HasObligation(obligations []string, name string) bool {
+    for _, o := range obligations { if o == name || strings.HasSuffix(name, ":") && strings.HasPrefix(o, name) { return true } }
+    return false
+}
+
+// MaxBytesObligation returns the smallest max-bytes limit, or 0 if none.
+func MaxBytesObligation(obligations []string) int {
+    limit := 0
+    for _, o := range obligations {
+        v, ok := strings.CutPrefix(o, ObligationMaxBytes)
+        if !ok { continue }
+        n, err := strconv.Atoi(v)
+        if err != nil || n <= 0 { continue }
+        if limit == 0 || n < limit { limit = n }
+    }
+    return limit
+}
+
+var (
+    piiEmail = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+    piiPhone = regexp.MustCompile(`\+?\d[\d\s().\-]{7,}\d`)
+)
+
+// ApplyObligations enforces output obligations on a tool result: PII
+// redaction first, then the byte cap (cut on a UTF-8 boundary).
+func ApplyObligations(obligations []string, out string) string {
+    if HasObligation(obligations, ObligationRedactPII) {
+        out = piiEmail.ReplaceAllString(out, "[redacted-email]")
+        out = piiPhone.ReplaceAllString(out, "[redacted-phone]")
+    }
+    if n := MaxBytesObligation(obligations); n > 0 { out = truncateUTF8(out, n) }
+    return out
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a rune.
+func truncateUTF8(s string, n int) string {
+    if len(s) <= n { return s }
+    for n > 0 && !utf8.RuneStart(s[n]) { n-- }
+    return s[:n]
+}
@@ -14,8 +14,24 @@ type ollamaReq struct { Model, Prompt string; Stream bool }
 type ollamaResp struct { Response string }
 type pullReq struct { Name string `json:"name"` }
 type tagsResp struct {
-    Models []struct{ Name string `json:"name"` } `json:"models"`
+    Models []struct{ Name string `json:"name"`; Digest string `json:"digest"` } `json:"models"`
 }
+// GenerateOptions pins sampling for reproducible generations.
+type GenerateOptions struct {
+    Temperature float64 `json:"temperature"`
+    Seed        int     `json:"seed"`
+    // Format is passed through to Ollama ("json" requests a JSON object).
+    Format      string  `json:"-"`
+}
+type generateReq struct {
+    Model   string          `json:"model"`
+    Prompt  string          `json:"prompt"`
+    Stream  bool            `json:"stream"`
+    Format  string          `json:"format,omitempty"`
+    Options GenerateOptions `json:"options"`
+}
+type embedReq struct { Model string `json:"model"`; Prompt string `json:"prompt"` }
+type embedResp struct { Embedding []float64 `json:"embedding"` }
 
 func (c *OllamaClient) Generate(prompt string) (string, error) {
 	req := ollamaReq{Model: c.Model, Prompt: prompt, Stream: false}
@@ -46,6 +62,52 @@ func (c *OllamaClient) Generate(prompt string) (string, error) {
 	return out.Response, nil
 }
 
+// GenerateWith runs a non-streaming generation with pinned options. Unlike
+// Generate it never pulls models, so results depend only on the model present.
+func (c *OllamaClient) GenerateWith(prompt string, opts GenerateOptions) (string, error) {
+    b, _ := json.Marshal(generateReq{Model: c.Model, Prompt: prompt, Format: opts.Format, Options: opts})
+    resp, err := c.HTTP.Post(c.BaseURL+"/api/generate", "application/json", bytes.NewReader(b))
+    if err != nil { return "", err }
+    defer resp.Body.Close()
+    if resp.StatusCode != 200 {
+        body, _ := io.ReadAll(resp.Body)
+        return "", fmt.Errorf("ollama non-200: %d: %s", resp.StatusCode, string(body))
+    }
+    var out ollamaResp
+    if err := json.NewDecoder(resp.Body).Decode(&out); err != nil { return "", err }
+    return out.Response, nil
+}
+
+// Embed returns the embedding vector for text via /api/embeddings.
+func (c *OllamaClient) Embed(text string) ([]float64, error) {
+    b, _ := json.Marshal(embedReq{Model: c.Model, Prompt: text})
+    resp, err := c.HTTP.Post(c.BaseURL+"/api/embeddings", "application/json", bytes.NewReader(b))
+    if err != nil { return nil, err }
+    defer resp.Body.Close()
+    if resp.StatusCode != 200 {
+        body, _ := io.ReadAll(resp.Body)
+        return nil, fmt.Errorf("ollama embeddings non-200: %d: %s", resp.StatusCode, string(body))
+    }
+    var out embedResp
+    if err := json.NewDecoder(resp.Body).Decode(&out); err != nil { return nil, err }
+    if len(out.Embedding) == 0 { return nil, fmt.Errorf("ollama embeddings: empty vector") }
+    return out.Embedding, nil
+}
+
+// ModelDigest returns the digest /api/tags reports for the configured model.
+func (c *OllamaClient) ModelDigest() (string, error) {
+    resp, err := c.HTTP.Get(c.BaseURL+"/api/tags")
+    if err != nil { return "", err }
+    defer resp.Body.Close()
+    if resp.StatusCode != 200 { return "", fmt.Errorf("tags status: %d", resp.StatusCode) }
+    var tr tagsResp
+    if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil { return "", err }
+    for _, m := range tr.Models {
+        if m.Name == c.Model || m.Name == c.Model+":latest" { return m.Digest, nil }
+    }
+    return "", fmt.Errorf("model %s not present", c.Model)
+}
+
 // EnsureModel pulls the configured model if needed, ignoring already-present cases.
 func (c *OllamaClient) EnsureModel() error {
     pr := pullReq{Name: c.Model}
@@ -120,7 +182,6 @@ func (c *OllamaClient) PullStream(cb func(map[string]any) error) error {
         }
         if err := cb(m); err != nil { return err }
     }
-    return nil
 }
 
 
@@ -0,0 +1,122 @@
+package ais
+
+import (
+    "bytes"
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strings"
+    "sync"
+    "time"
+)
+
+// PolicyDecisionPoint is consulted by the guard after its own checks pass.
+type PolicyDecisionPoint interface {
+    Decide(ctx context.Context, in PDPInput) (PDPDecision, error)
+}
+
+// PDPInput is the document a PDP evaluates for one guarded call.
+type PDPInput struct {
+    UIA  UIA     `json:"uia"`
+    APA  APA     `json:"apa"`
+    Step APAStep `json:"step"`
+    TCA  TCA     `json:"tca"`
+    IBE  IBE     `json:"ibe"`
+}
+
+// PDPDecision is a PDP verdict; Reasons explain a deny.
+type PDPDecision struct {
+    Allow   bool     `json:"allow"`
+    Reasons []string `json:"reasons,omitempty"`
+}
+
+// OPAClient is a PolicyDecisionPoint backed by an OPA-compatible Data API. It
+// POSTs {"input": PDPInput} to <URL>/v1/data/<Path> and accepts either a
+// boolean result or an object {allow, reasons, deny}: the call is allowed when
+// allow is true and deny is empty. An undefined result denies.
+//
+// Decisions are cached for CacheTTL keyed by the input without the per-call
+// IBE fields (id, nonce, expiry, signature); transport errors are not cached.
+type OPAClient struct {
+    URL      string
+    Path     string
+    Timeout  time.Duration
+    CacheTTL time.Duration
+    HTTP     *http.Client
+
+    mu    sync.Mutex
+    cache map[string]pdpCacheEntry
+}
+
+type pdpCacheEntry struct {
+    d   PDPDecision
+    exp time.Time
+}
+
+func (c *OPAClient) Decide(ctx context.Context, in PDPInput) (PDPDecision, error) {
+    key := pdpCacheKey(in)
+    now := time.Now()
+    if c.CacheTTL > 0 {
+        c.mu.Lock()
+        e, ok := c.cache[key]
+        c.mu.Unlock()
+        if ok && now.Before(e.exp) { return e.d, nil }
+    }
+    if c.Timeout > 0 {
+        var cancel context.CancelFunc
+        ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+        defer cancel()
+    }
+    body, err := json.Marshal(map[string]any{"input": in})
+    if err != nil { return PDPDecision{}, err }
+    url := strings.TrimRight(c.URL, "/") + "/v1/data/" + strings.Trim(c.Path, "/")
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+    if err != nil { return PDPDecision{}, err }
+    req.Header.Set("content-type", "application/json")
+    hc := c.HTTP
+    if hc == nil { hc = http.DefaultClient }
+    resp, err := hc.Do(req)
+    if err != nil { return PDPDecision{}, err }
+    defer resp.Body.Close()
+    if resp.StatusCode != 200 { return PDPDecision{}, fmt.Errorf("pdp status %d", resp.StatusCode) }
+    var out struct{ Result json.RawMessage `json:"result"` }
+    if err := json.NewDecoder(resp.Body).Decode(&out); err != nil { return PDPDecision{}, err }
+    d, err := parseOPAResult(out.Result)
+    if err != nil { return PDPDecision{}, err }
+    if c.CacheTTL > 0 {
+        c.mu.Lock()
+        if c.cache == nil { c.cache = map[string]pdpCacheEntry{} }
+        for k, e := range c.cache { if now.After(e.exp) { delete(c.cache, k) } }
+        c.cache[key] = pdpCacheEntry{d: d, exp: now.Add(c.CacheTTL)}
+        c.mu.Unlock()
+    }
+    return d, nil
+}
+
+func parseOPAResult(raw json.RawMessage) (PDPDecision, error) {
+    if len(raw) == 0 || string(raw) == "null" { return PDPDecision{Reasons: []string{"policy decision undefined"}}, nil }
+    var allow bool
+    if json.Unmarshal(raw, &allow) == nil {
+        if allow { return PDPDecision{Allow: true}, nil }
+        return PDPDecision{Reasons: []string{"denied by policy"}}, nil
+    }
+    var obj struct {
+        Allow   bool     `json:"allow"`
+        Reasons []string `json:"reasons"`
+        Deny    []string `json:"deny"`
+    }
+    if err := json.Unmarshal(raw, &obj); err != nil { return PDPDecision{}, fmt.Errorf("pdp result: %w", err) }
+    d := PDPDecision{Allow: obj.Allow && len(obj.Deny) == 0, Reasons: append(obj.Deny, obj.Reasons...)}
+    if !d.Allow && len(d.Reasons) == 0 { d.Reasons = []string{"denied by policy"} }
+    return d, nil
+}
+
+func pdpCacheKey(in PDPInput) string {
+    in.IBE.ID, in.IBE.Nonce, in.IBE.Sig, in.IBE.Exp = "", "", "", time.Time{}
+    b, _ := marshalCanonical(in)
+    sum := sha256.Sum256(b)
+    return hex.EncodeToString(sum[:])
+}
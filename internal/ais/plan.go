@@ -0,0 +1,235 @@
+package ais
+
+import (
+    "encoding/json"
+    "errors"
+    "regexp"
+    "slices"
+    "strings"
+)
+
+// ErrStepRefUnresolved is returned for a reference to a step that is not an
+// earlier step of the plan, or that has not produced an output.
+var ErrStepRefUnresolved = errors.New("APA-REF-UNRESOLVED")
+
+// ErrStepRefType is returned for a ${steps.<id>.json...} reference whose
+// step output is not JSON or has no value at the path.
+var ErrStepRefType = errors.New("APA-REF-TYPE-MISMATCH")
+
+// PlanError is APA-PLAN-INVALID: the plan's step ids, dependencies, guards or
+// references are malformed. Reason says which.
+type PlanError struct {
+    Step   string
+    Reason string
+}
+
+func (e *PlanError) Error() string { return "APA-PLAN-INVALID" }
+
+// stepRefPattern matches a reference in step args: ${steps.<id>.output} is
+// the step's output text, ${steps.<id>.json} the output parsed as JSON and
+// ${steps.<id>.json.<path>} a value in it, e.g. ${steps.s1.json.items[0].url}.
+// A string that is exactly one reference takes the value's JSON type; a
+// reference inside a longer string is replaced by its text.
+var stepRefPattern = regexp.MustCompile(`\$\{(steps\.([A-Za-z0-9_]+)\.(?:output|json(?:\.[A-Za-z0-9_]+|\[[0-9]+\])*))\}`)
+
+// HasStepRefs reports whether args contain a ${steps...} reference.
+func HasStepRefs(args map[string]any) bool {
+    found := false
+    walkStrings(args, func(s string) { found = found || strings.Contains(s, "${steps.") })
+    return found
+}
+
+func walkStrings(v any, fn func(string)) {
+    switch x := v.(type) {
+    case string:
+        fn(x)
+    case map[string]any:
+        for _, e := range x { walkStrings(e, fn) }
+    case []any:
+        for _, e := range x { walkStrings(e, fn) }
+    }
+}
+
+// argRefs lists the steps referenced in a step's args.
+func argRefs(step APAStep) []string {
+    var ids []string
+    walkStrings(step.Args, func(s string) {
+        for _, m := range stepRefPattern.FindAllStringSubmatch(s, -1) { ids = append(ids, m[2]) }
+    })
+    return ids
+}
+
+// StepDeps returns the steps a step depends on: its After list, the steps
+// its args reference and the steps its guard reads.
+func StepDeps(step APAStep) ([]string, error) {
+    deps := append(append([]string{}, step.After...), argRefs(step)...)
+    if step.When == "" { return deps, nil }
+    e, err := ParseExpr(step.When)
+    if err != nil { return nil, &PlanError{Step: step.ID, Reason: "when: " + err.Error()} }
+    ids, ok := exprStepRefs(e)
+    if !ok { return nil, &PlanError{Step: step.ID, Reason: "when must read earlier steps as steps.<id>"} }
+    return append(deps, ids...), nil
+}
+
+// ValidatePlan checks the plan's dataflow: step ids are unique, every
+// dependency (After, args references, guard reads) names an earlier step,
+// references are well formed and guards parse. Steps run in plan order, so
+// dependencies cannot form cycles.
+func ValidatePlan(apa APA) error {
+    seen := map[string]bool{}
+    for _, s := range apa.Steps {
+        if s.ID == "" || seen[s.ID] { return &PlanError{Step: s.ID, Reason: "step ids must be unique and non-empty"} }
+        malformed := false
+        walkStrings(s.Args, func(str string) {
+            if strings.Count(str, "${steps.") != len(stepRefPattern.FindAllStringIndex(str, -1)) { malformed = true }
+        })
+        if malformed { return &PlanError{Step: s.ID, Reason: "malformed ${steps...} reference"} }
+        for _, d := range s.After {
+            if !seen[d] { return &PlanError{Step: s.ID, Reason: "after names " + d + ", which is not an earlier step"} }
+        }
+        deps, err := StepDeps(s)
+        if err != nil { return err }
+        for _, d := range deps { if !seen[d] { return ErrStepRefUnresolved } }
+        seen[s.ID] = true
+    }
+    return nil
+}
+
+// stepsEnv is the "steps" value guards and references read: per settled
+// step its output text, the output parsed as JSON (null if it is not JSON)
+// and whether it was skipped.
+func stepsEnv(outputs map[string]string, skipped map[string]bool) map[string]any {
+    env := map[string]any{}
+    for id, out := range outputs {
+        var parsed any
+        if json.Unmarshal([]byte(out), &parsed) != nil { parsed = nil }
+        env[id] = map[string]any{"output": out, "json": parsed, "skipped": false}
+    }
+    for id := range skipped { env[id] = map[string]any{"output": nil, "json": nil, "skipped": true} }
+    return env
+}
+
+// ResolveArgs returns a copy of args with the ${steps...} references filled
+// in from the outputs of earlier steps. args itself is not modified, so the
+// signed APA keeps the references it was verified with.
+func ResolveArgs(args map[string]any, outputs map[string]string) (map[string]any, error) {
+    env := map[string]any{"steps": stepsEnv(outputs, nil)}
+    v, err := resolveValue(args, env)
+    if err != nil { return nil, err }
+    out, _ := v.(map[string]any)
+    return out, nil
+}
+
+func resolveValue(v any, env map[string]any) (any, error) {
+    switch x := v.(type) {
+    case string:
+        if m := stepRefPattern.FindStringSubmatchIndex(x); m != nil && m[0] == 0 && m[1] == len(x) {
+            return resolveRef(x[m[2]:m[3]], x[m[4]:m[5]], env)
+        }
+        var err error
+        s := stepRefPattern.ReplaceAllStringFunc(x, func(ref string) string {
+            sm := stepRefPattern.FindStringSubmatch(ref)
+            val, rerr := resolveRef(sm[1], sm[2], env)
+            if rerr != nil { err = rerr }
+            return exprString(val)
+        })
+        return s, err
+    case map[string]any:
+        if x == nil { return x, nil }
+        m := make(map[string]any, len(x))
+        for k, e := range x {
+            r, err := resolveValue(e, env)
+            if err != nil { return nil, err }
+            m[k] = r
+        }
+        return m, nil
+    case []any:
+        l := make([]any, len(x))
+        for i, e := range x {
+            r, err := resolveValue(e, env)
+            if err != nil { return nil, err }
+            l[i] = r
+        }
+        return l, nil
+    }
+    return v, nil
+}
+
+// resolveRef evaluates the reference path (steps.<id>.output|json...)
+// against the settled steps.
+func resolveRef(path, id string, env map[string]any) (any, error) {
+    if _, ok := env["steps"].(map[string]any)[id]; !ok { return nil, ErrStepRefUnresolved }
+    e, err := ParseExpr(path)
+    if err != nil { return nil, ErrStepRefUnresolved }
+    v, err := e.Eval(env)
+    if err != nil || v == nil { return nil, ErrStepRefType }
+    return v, nil
+}
+
+// MatchArgs reports whether args are template with its references filled
+// in: literal parts are equal, a string that is exactly one reference
+// matches any value and a string embedding references matches any string
+// with the same text around them.
+func MatchArgs(template, args map[string]any) bool { return matchValue(template, args) }
+
+func matchValue(t, v any) bool {
+    switch x := t.(type) {
+    case string:
+        if !strings.Contains(x, "${steps.") { break }
+        if m := stepRefPattern.FindStringIndex(x); m != nil && m[0] == 0 && m[1] == len(x) { return true }
+        s, ok := v.(string)
+        if !ok { return false }
+        parts := stepRefPattern.Split(x, -1)
+        for i := range parts { parts[i] = regexp.QuoteMeta(parts[i]) }
+        re, err := regexp.Compile(`^(?s:` + strings.Join(parts, ".*") + `)$`)
+        return err == nil && re.MatchString(s)
+    case map[string]any:
+        y, ok := v.(map[string]any)
+        if !ok || len(x) != len(y) { return false }
+        for k, e := range x {
+            ye, ok := y[k]
+            if !ok || !matchValue(e, ye) { return false }
+        }
+        return true
+    case []any:
+        y, ok := v.([]any)
+        if !ok || len(x) != len(y) { return false }
+        for i := range x { if !matchValue(x[i], y[i]) { return false } }
+        return true
+    }
+    a, err1 := marshalCanonical(t)
+    b, err2 := marshalCanonical(v)
+    return err1 == nil && err2 == nil && string(a) == string(b)
+}
+
+// checkBranches holds every reachable branch of the plan to the UIA. A step
+// under a guard, or depending on one, runs only if the guard holds at run
+// time, so the plan's coverage cannot vouch for it: each must be permitted
+// its data classes and meet the step alignment threshold (minStep) on its own. Guards that
+// read no step outputs are decided here against the UIA; a step they rule
+// out, or whose args need a step that cannot run, is unreachable and the
+// IBE's step (stepID) must not be.
+func checkBranches(uia UIA, apa APA, ev APrEvidence, minStep float64, stepID string) error {
+    env := ExprEnv(map[string]any{"uia": uia, "apa": apa})
+    reach, guarded := map[string]bool{}, map[string]bool{}
+    for _, s := range apa.Steps {
+        r, g := true, s.When != ""
+        for _, d := range argRefs(s) { if !reach[d] { r = false } }
+        deps, _ := StepDeps(s)
+        for _, d := range deps { if guarded[d] { g = true } }
+        if r && s.When != "" {
+            e, _ := ParseExpr(s.When)
+            if ids, _ := exprStepRefs(e); len(ids) == 0 {
+                if b, err := EvalBool(e, env); err == nil && !b { r = false }
+            }
+        }
+        reach[s.ID], guarded[s.ID] = r, g
+        if !r || !g { continue }
+        for _, dc := range s.Expected.DataClasses {
+            if !slices.Contains(uia.Constraints.DataClasses, dc) { return errors.New("DATA-CLASS-NOT-PERMITTED") }
+        }
+        if se, ok := stepEvidence(ev, s.ID); ok && se.Score < minStep { return errors.New("ALIGN-BRANCH-BELOW-THRESHOLD") }
+    }
+    if !reach[stepID] { return errors.New("IBE-STEP-UNREACHABLE") }
+    return nil
+}
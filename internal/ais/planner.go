@@ -0,0 +1,220 @@
+package ais
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "slices"
+    "strings"
+)
+
+// Planner turns a UIA into an APA using the operations of the given TCAs.
+// The APA comes back unsigned and without alignment scores; the caller
+// proves and signs it.
+type Planner interface {
+    Plan(uia UIA, tcas []TCA) (APA, error)
+}
+
+// plannerPromptTemplate asks for a plan as JSON. Changing it changes the
+// plans a pinned model produces.
+const plannerPromptTemplate = `You are the planner of an agent runtime. Break the intent into tool steps. Answer with a JSON object only.
+Intent: %s
+Constraints: dataClasses=%s; maxWrites=%d; maxRecords=%d; maxExternalCalls=%d; policyProfile=%s
+Tools (name, TCA, effects, argsSchema):
+%s
+Respond as {"steps": [{"id": "s1", "tool": "<tool name>", "args": {...}}]} with at most %d steps, ids s1, s2, ... in order.
+Args must satisfy the tool's argsSchema. A step may use an earlier step's output as "${steps.<id>.output}" in a string arg.
+Optional per step: "after": [earlier step ids] it must follow, "when": a guard such as "steps.s1.output != \"\"", "dataClasses": a subset of the tool's.`
+
+// plannerRepairTemplate follows the prompt when the previous answer was
+// rejected.
+const plannerRepairTemplate = `
+
+Your previous answer was rejected: %s
+Previous answer:
+%s
+Answer with the corrected JSON object only.`
+
+// Planner defaults for fields OllamaPlanner leaves unset.
+const (
+    DefaultPlannerSeed     = 42
+    DefaultPlannerRepairs  = 1
+    DefaultPlannerMaxSteps = 8
+)
+
+// apaSchema is the APA schema of spec/AIS-schemas.md; planned APAs are
+// checked against it before they are returned.
+var apaSchema = mustSchema(`{
+  "type": "object",
+  "required": ["@type", "id", "uia", "model", "steps", "totals", "proof"],
+  "properties": {
+    "@type": {"const": "APA"},
+    "id": {"type": "string"},
+    "uia": {"type": "string"},
+    "model": {"type": "object", "required": ["hash"], "properties": {"vendor": {"type": "string"}, "version": {"type": "string"}, "hash": {"type": "string"}}},
+    "steps": {
+      "type": "array",
+      "items": {"type": "object", "required": ["id", "tool", "args", "expected", "alignment"],
+        "properties": {
+          "id": {"type": "string"},
+          "tool": {"type": "string"},
+          "args": {"type": "object"},
+          "after": {"type": "array", "items": {"type": "string"}},
+          "when": {"type": "string"},
+          "expected": {"type": "object", "required": ["dataClasses", "writes"], "properties": {"dataClasses": {"type": "array", "items": {"type": "string"}}, "writes": {"type": "integer"}}},
+          "alignment": {"type": "object", "required": ["score"], "properties": {"score": {"type": "number", "minimum": 0, "maximum": 1}, "why": {"type": "string"}}}
+        }}
+    },
+    "totals": {"type": "object", "required": ["predictedWrites", "predictedRecords"], "properties": {"predictedWrites": {"type": "integer"}, "predictedRecords": {"type": "integer"}}},
+    "proof": {"type": "object"}
+  }
+}`)
+
+func mustSchema(s string) map[string]any {
+    var m map[string]any
+    if err := json.Unmarshal([]byte(s), &m); err != nil { panic(err) }
+    return m
+}
+
+// OllamaPlanner plans with a local Ollama model at temperature 0 and a fixed
+// seed, so a pinned model gives the same plan for the same UIA and tools. The
+// model's answer must match the plan draft schema, reference only earlier
+// steps, satisfy each tool's args schema and stay within the UIA's budget;
+// otherwise the model is asked to repair it, and the plan is rejected with a
+// *PlanError once the repairs are used up.
+type OllamaPlanner struct {
+    Client   *OllamaClient
+    Seed     int
+    // Repairs is how often an invalid answer is sent back for correction;
+    // 0 means DefaultPlannerRepairs, negative none.
+    Repairs  int
+    MaxSteps int
+}
+
+type planDraft struct {
+    Steps []struct {
+        ID          string         `json:"id"`
+        Tool        string         `json:"tool"`
+        Args        map[string]any `json:"args"`
+        After       []string       `json:"after"`
+        When        string         `json:"when"`
+        DataClasses []string       `json:"dataClasses"`
+    } `json:"steps"`
+}
+
+func (p OllamaPlanner) Plan(uia UIA, tcas []TCA) (APA, error) {
+    seed, repairs, maxSteps := p.Seed, p.Repairs, p.MaxSteps
+    if seed == 0 { seed = DefaultPlannerSeed }
+    if repairs == 0 { repairs = DefaultPlannerRepairs }
+    if maxSteps <= 0 { maxSteps = DefaultPlannerMaxSteps }
+    digest, err := p.Client.ModelDigest()
+    if err != nil { return APA{}, err }
+    model := ModelInfo{Vendor: "ollama", Version: p.Client.Model, Hash: digest}
+    prompt := plannerPrompt(uia, tcas, maxSteps)
+    next := prompt
+    for attempt := 0; ; attempt++ {
+        out, err := p.Client.GenerateWith(next, GenerateOptions{Temperature: 0, Seed: seed, Format: "json"})
+        if err != nil { return APA{}, err }
+        apa, reason := buildPlan(uia, tcas, model, out, maxSteps)
+        if reason == "" { return apa, nil }
+        if attempt >= repairs { return APA{}, &PlanError{Reason: "planner: " + reason} }
+        next = prompt + fmt.Sprintf(plannerRepairTemplate, reason, strings.TrimSpace(out))
+    }
+}
+
+func plannerPrompt(uia UIA, tcas []TCA, maxSteps int) string {
+    var b strings.Builder
+    for _, t := range tcas {
+        for _, op := range t.Operations {
+            dc, _ := json.Marshal(op.Effects.DataClasses)
+            fmt.Fprintf(&b, "- %s (%s): writes=%d dataClasses=%s", op.Name, t.ID, op.Effects.Writes, dc)
+            if len(op.Effects.Destinations) > 0 { fmt.Fprintf(&b, " destinations=%s", strings.Join(op.Effects.Destinations, ",")) }
+            schema := op.ArgsSchema
+            if schema == nil { schema = map[string]any{"type": "object"} }
+            sb, _ := marshalCanonical(schema)
+            fmt.Fprintf(&b, " argsSchema=%s\n", sb)
+        }
+    }
+    dc, _ := json.Marshal(uia.Constraints.DataClasses)
+    rb := uia.RiskBudget
+    return fmt.Sprintf(plannerPromptTemplate, uia.Purpose, dc, rb.MaxWrites, rb.MaxRecords, rb.MaxExternalCalls, uia.PolicyProfile, strings.TrimRight(b.String(), "\n"), maxSteps)
+}
+
+// draftSchema is the shape of the model's answer; tool names are limited to
+// the operations of tcas.
+func draftSchema(tcas []TCA, maxSteps int) map[string]any {
+    var names []any
+    for _, t := range tcas {
+        for _, op := range t.Operations { names = append(names, op.Name) }
+    }
+    step := map[string]any{
+        "type": "object", "required": []any{"id", "tool", "args"}, "additionalProperties": false,
+        "properties": map[string]any{
+            "id":          map[string]any{"type": "string", "pattern": "^[A-Za-z0-9_]+$"},
+            "tool":        map[string]any{"enum": names},
+            "args":        map[string]any{"type": "object"},
+            "after":       map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+            "when":        map[string]any{"type": "string"},
+            "dataClasses": map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+        },
+    }
+    return map[string]any{
+        "type": "object", "required": []any{"steps"}, "additionalProperties": false,
+        "properties": map[string]any{"steps": map[string]any{"type": "array", "minItems": 1, "maxItems": maxSteps, "items": step}},
+    }
+}
+
+// buildPlan turns the model's answer into an APA, or says why it cannot.
+// Expected effects come from the tools' TCAs and the totals are summed over
+// all steps, branches included.
+func buildPlan(uia UIA, tcas []TCA, model ModelInfo, out string, maxSteps int) (APA, string) {
+    start, end := strings.Index(out, "{"), strings.LastIndex(out, "}")
+    if start < 0 || end < start { return APA{}, "no JSON object" }
+    var raw any
+    if err := json.Unmarshal([]byte(out[start:end+1]), &raw); err != nil { return APA{}, "invalid JSON: " + err.Error() }
+    if err := validateSchema(draftSchema(tcas, maxSteps), normalizeJSON(raw), "plan"); err != nil { return APA{}, err.Error() }
+    var d planDraft
+    if err := json.Unmarshal([]byte(out[start:end+1]), &d); err != nil { return APA{}, "invalid JSON: " + err.Error() }
+    apa := APA{Type: "APA", UIA: uia.ID, Model: model, Proof: map[string]any{}}
+    for _, ds := range d.Steps {
+        var tca TCA
+        var op *TCAOperation
+        for _, t := range tcas {
+            if o, ok := tcaOperation(t, ds.Tool); ok { tca, op = t, o; break }
+        }
+        if op.ArgsSchema != nil && !HasStepRefs(ds.Args) {
+            if err := ValidateSchema(op.ArgsSchema, ds.Args); err != nil { return APA{}, "step " + ds.ID + ": " + err.Error() }
+        }
+        dcs := ds.DataClasses
+        if dcs == nil { dcs = op.Effects.DataClasses }
+        for _, dc := range dcs {
+            if !slices.Contains(op.Effects.DataClasses, dc) { return APA{}, fmt.Sprintf("step %s: data class %s is not declared by %s", ds.ID, dc, tca.ID) }
+        }
+        if dcs == nil { dcs = []string{} }
+        apa.Steps = append(apa.Steps, APAStep{ID: ds.ID, Tool: ds.Tool, Args: ds.Args, After: ds.After, When: ds.When, Expected: StepExpected{DataClasses: dcs, Writes: op.Effects.Writes}})
+        apa.Totals.PredictedWrites += op.Effects.Writes
+        apa.Totals.PredictedRecords++
+        if ExternalCall(ds.Tool) { apa.Totals.PredictedExternalCalls++ }
+    }
+    if err := ValidatePlan(apa); err != nil {
+        if errors.Is(err, ErrStepRefUnresolved) { return APA{}, "a step reads a step that is not earlier in the plan" }
+        return APA{}, planReason(err)
+    }
+    rb := uia.RiskBudget
+    switch {
+    case apa.Totals.PredictedWrites > rb.MaxWrites:
+        return APA{}, fmt.Sprintf("plan writes %d times, the intent allows %d", apa.Totals.PredictedWrites, rb.MaxWrites)
+    case apa.Totals.PredictedRecords > rb.MaxRecords:
+        return APA{}, fmt.Sprintf("plan returns %d records, the intent allows %d", apa.Totals.PredictedRecords, rb.MaxRecords)
+    case apa.Totals.PredictedExternalCalls > rb.MaxExternalCalls:
+        return APA{}, fmt.Sprintf("plan makes %d external calls, the intent allows %d", apa.Totals.PredictedExternalCalls, rb.MaxExternalCalls)
+    }
+    // the same plan for the same intent and model gets the same id
+    b, _ := marshalCanonical(apa)
+    sum := sha256.Sum256(b)
+    apa.ID = "urn:apa:" + hex.EncodeToString(sum[:8])
+    if err := validateSchema(apaSchema, normalizeJSON(apa), "apa"); err != nil { return APA{}, err.Error() }
+    return apa, ""
+}
@@ -0,0 +1,65 @@
+package ais
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+    "slices"
+)
+
+// PolicyFixture is a policy unit test: a UIA/APA input and the evaluation the
+// profile's policy must produce. UIA and APA are inline objects or paths
+// relative to the fixture file. Only the Expect fields that are set are checked.
+type PolicyFixture struct {
+    Name    string          `json:"name"`
+    // Profile overrides uia.policyProfile.
+    Profile string          `json:"profile,omitempty"`
+    UIA     json.RawMessage `json:"uia"`
+    APA     json.RawMessage `json:"apa"`
+    Expect  struct {
+        Coverage    *float64           `json:"coverage,omitempty"`
+        Risk        *float64           `json:"risk,omitempty"`
+        Obligations *[]string          `json:"obligations,omitempty"`
+        Denials     *[]string          `json:"denials,omitempty"`
+        Steps       map[string]float64 `json:"steps,omitempty"`
+    } `json:"expect"`
+}
+
+// RunPolicyFixture evaluates one fixture file and returns its name and the
+// list of expectation failures (empty when it passes).
+func RunPolicyFixture(e *PolicyEngine, path string) (string, []string, error) {
+    b, err := os.ReadFile(path)
+    if err != nil { return "", nil, err }
+    var fx PolicyFixture
+    if err := json.Unmarshal(b, &fx); err != nil { return "", nil, fmt.Errorf("%s: %w", path, err) }
+    if fx.Name == "" { fx.Name = filepath.Base(path) }
+    var uia UIA
+    var apa APA
+    if err := fixtureInput(filepath.Dir(path), fx.UIA, &uia); err != nil { return fx.Name, nil, fmt.Errorf("%s: uia: %w", path, err) }
+    if err := fixtureInput(filepath.Dir(path), fx.APA, &apa); err != nil { return fx.Name, nil, fmt.Errorf("%s: apa: %w", path, err) }
+    if fx.Profile != "" { uia.PolicyProfile = fx.Profile }
+    ev := e.For(uia.PolicyProfile).Evaluate(uia, apa)
+    var fails []string
+    if x := fx.Expect.Coverage; x != nil && abs(*x-ev.Coverage) > 1e-9 { fails = append(fails, fmt.Sprintf("coverage: want %v got %v", *x, ev.Coverage)) }
+    if x := fx.Expect.Risk; x != nil && abs(*x-ev.Risk) > 1e-9 { fails = append(fails, fmt.Sprintf("risk: want %v got %v", *x, ev.Risk)) }
+    if x := fx.Expect.Obligations; x != nil && !slices.Equal(*x, ev.Obligations) && len(*x)+len(ev.Obligations) > 0 { fails = append(fails, fmt.Sprintf("obligations: want %q got %q", *x, ev.Obligations)) }
+    if x := fx.Expect.Denials; x != nil && !slices.Equal(*x, ev.Denials) && len(*x)+len(ev.Denials) > 0 { fails = append(fails, fmt.Sprintf("denials: want %q got %q", *x, ev.Denials)) }
+    for id, want := range fx.Expect.Steps {
+        se, ok := stepEvidence(ev, id)
+        if !ok || abs(se.Score-want) > 1e-9 { fails = append(fails, fmt.Sprintf("step %s: want %v got %v", id, want, se.Score)) }
+    }
+    slices.Sort(fails)
+    return fx.Name, fails, nil
+}
+
+func fixtureInput(dir string, raw json.RawMessage, v any) error {
+    var ref string
+    if json.Unmarshal(raw, &ref) == nil {
+        if !filepath.IsAbs(ref) { ref = filepath.Join(dir, ref) }
+        b, err := os.ReadFile(ref)
+        if err != nil { return err }
+        raw = b
+    }
+    return json.Unmarshal(raw, v)
+}
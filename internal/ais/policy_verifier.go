@@ -1,34 +1,229 @@
 package ais
 
-import "strings"
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+    "slices"
+    "strings"
+)
+
+// Policy is a declarative external-policy-v1 rule set for one policy profile.
+// Step rules run once per APA step with "step" bound; plan rules run once.
+// Every rule expression (see Expr) can read:
+//   uia, apa       the full UIA and APA as JSON
+//   step           the current step (step rules only)
+//   tools          the tool of every plan step, in order
+//   purposeTerms   keywords extracted from uia.purpose
+type Policy struct {
+    Profile     string       `json:"profile"`
+    Description string       `json:"description,omitempty"`
+    StepRules   []PolicyRule `json:"stepRules,omitempty"`
+    PlanRules   []PolicyRule `json:"planRules,omitempty"`
+
+    digest string
+}
+
+// PolicyRule applies its effects when When (default true) holds. In step rules
+// Align marks the step as aligned; Risk is added to the plan risk, Obligation
+// is attached to the APr and Deny records a deny reason.
+type PolicyRule struct {
+    ID         string  `json:"id"`
+    When       string  `json:"when,omitempty"`
+    Align      string  `json:"align,omitempty"`
+    Risk       float64 `json:"risk,omitempty"`
+    Obligation string  `json:"obligation,omitempty"`
+    Deny       string  `json:"deny,omitempty"`
+
+    when, align Expr
+}
+
+// Compile parses every rule expression and pins the policy digest.
+func (p *Policy) Compile() error {
+    for _, rules := range [][]PolicyRule{p.StepRules, p.PlanRules} {
+        for i := range rules {
+            r := &rules[i]
+            if r.ID == "" { return fmt.Errorf("policy %s: rule %d has no id", p.Profile, i) }
+            var err error
+            if r.When != "" {
+                if r.when, err = ParseExpr(r.When); err != nil { return fmt.Errorf("policy %s rule %s: when: %w", p.Profile, r.ID, err) }
+            }
+            if r.Align != "" {
+                if r.align, err = ParseExpr(r.Align); err != nil { return fmt.Errorf("policy %s rule %s: align: %w", p.Profile, r.ID, err) }
+            }
+        }
+    }
+    for _, r := range p.PlanRules {
+        if r.Align != "" { return fmt.Errorf("policy %s rule %s: align is only valid in step rules", p.Profile, r.ID) }
+    }
+    b, err := marshalCanonical(p)
+    if err != nil { return err }
+    sum := sha256.Sum256(b)
+    p.digest = "sha256:" + hex.EncodeToString(sum[:])
+    return nil
+}
+
+// Digest is the sha256 of the policy's canonical JSON, recorded in evidence.
+func (p *Policy) Digest() string { return p.digest }
+
+// DefaultPolicy is used for profiles without a policy file. A step is aligned
+// when its prompt or url mentions a purpose keyword; writes add 0.5 risk and
+// http.get plans carry the default obligations (see DeriveObligations).
+func DefaultPolicy() *Policy {
+    p := &Policy{
+        Profile:     "default",
+        Description: "purpose keywords in prompt/url; writes add risk",
+        StepRules: []PolicyRule{
+            {ID: "generate-mentions-purpose", When: "step.tool == 'ollama.generate'", Align: "hasAny(lower(step.args.prompt), purposeTerms)"},
+            {ID: "http-mentions-purpose", When: "step.tool == 'http.get'", Align: "hasAny(lower(step.args.url), purposeTerms)"},
+        },
+        PlanRules: []PolicyRule{
+            {ID: "writes", When: "apa.totals.predictedWrites > 0", Risk: 0.5},
+            {ID: "cap-fetched-output", When: "'http.get' in tools", Obligation: "max-bytes:2000"},
+            {ID: "redact-fetched-pii", When: "'http.get' in tools && !('pii' in uia.constraints.dataClasses)", Obligation: ObligationRedactPII},
+            {ID: "external-budget-spent", When: "'http.get' in tools && uia.riskBudget.maxExternalCalls <= count(tools, 'http.get')", Obligation: ObligationNoFollowupHTTP},
+        },
+    }
+    if err := p.Compile(); err != nil { panic(err) }
+    return p
+}
+
+// PolicyEngine holds compiled policies keyed by policy profile.
+type PolicyEngine struct{ policies map[string]*Policy }
+
+// NewPolicyEngine compiles the given policies.
+func NewPolicyEngine(policies ...*Policy) (*PolicyEngine, error) {
+    e := &PolicyEngine{policies: map[string]*Policy{}}
+    for _, p := range policies {
+        if err := p.Compile(); err != nil { return nil, err }
+        if _, dup := e.policies[p.Profile]; dup { return nil, fmt.Errorf("duplicate policy for profile %q", p.Profile) }
+        e.policies[p.Profile] = p
+    }
+    return e, nil
+}
+
+// LoadPolicies reads every *.json policy file in dir.
+func LoadPolicies(dir string) (*PolicyEngine, error) {
+    files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+    if err != nil { return nil, err }
+    slices.Sort(files)
+    var policies []*Policy
+    for _, f := range files {
+        b, err := os.ReadFile(f)
+        if err != nil { return nil, err }
+        p := &Policy{}
+        if err := json.Unmarshal(b, p); err != nil { return nil, fmt.Errorf("%s: %w", f, err) }
+        if p.Profile == "" { p.Profile = strings.TrimSuffix(filepath.Base(f), ".json") }
+        policies = append(policies, p)
+    }
+    return NewPolicyEngine(policies...)
+}
+
+// For returns the policy for a profile, falling back to the "default" file and
+// then to DefaultPolicy.
+func (e *PolicyEngine) For(profile string) *Policy {
+    if e != nil {
+        if p, ok := e.policies[profile]; ok { return p }
+        if p, ok := e.policies["default"]; ok { return p }
+    }
+    return builtinPolicy
+}
+
+// Profiles returns the profiles with a loaded policy, sorted.
+func (e *PolicyEngine) Profiles() []string {
+    out := make([]string, 0, len(e.policies))
+    for p := range e.policies { out = append(out, p) }
+    slices.Sort(out)
+    return out
+}
+
+var builtinPolicy = DefaultPolicy()
+
+// Evaluate runs the profile's policy over a plan. Coverage is the fraction of
+// aligned steps and risk the clamped sum of matching rule risks. A rule that
+// fails to evaluate denies the plan, so policy bugs fail closed.
+func (p *Policy) Evaluate(uia UIA, apa APA) APrEvidence {
+    return p.evaluate(uia, apa, extractKeywords(strings.ToLower(uia.Purpose)))
+}
+
+// evaluate is Evaluate with purposeTerms bound to kws.
+func (p *Policy) evaluate(uia UIA, apa APA, kws []string) APrEvidence {
+    ev := APrEvidence{PolicyDigest: p.digest}
+    if len(apa.Steps) == 0 { ev.Risk = 1; return ev }
+    tools := make([]any, 0, len(apa.Steps))
+    for _, s := range apa.Steps { tools = append(tools, s.Tool) }
+    terms := make([]any, 0, len(kws))
+    for _, t := range kws { terms = append(terms, t) }
+    env := ExprEnv(map[string]any{"uia": uia, "apa": apa})
+    env["tools"], env["purposeTerms"] = tools, terms
+    obligations := map[string]bool{}
+    apply := func(r PolicyRule, env map[string]any, where string) (matched bool) {
+        fail := func(err error) { ev.Denials = append(ev.Denials, r.ID+where+": evaluation error: "+err.Error()) }
+        if r.when != nil {
+            ok, err := EvalBool(r.when, env)
+            if err != nil { fail(err); return false }
+            if !ok { return false }
+        }
+        ev.Risk += r.Risk
+        if r.Obligation != "" { obligations[r.Obligation] = true }
+        if r.Deny != "" { ev.Denials = append(ev.Denials, r.ID+where+": "+r.Deny) }
+        if r.align == nil { return false }
+        ok, err := EvalBool(r.align, env)
+        if err != nil { fail(err); return false }
+        return ok
+    }
+    aligned := 0
+    for _, s := range apa.Steps {
+        senv := make(map[string]any, len(env)+1)
+        for k, v := range env { senv[k] = v }
+        senv["step"] = toGeneric(s)
+        se := StepEvidence{Step: s.ID, Matched: matchedTerms(stepText(s), kws), Reason: "no aligning rule"}
+        for _, r := range p.StepRules {
+            if apply(r, senv, " ("+s.ID+")") && se.Score == 0 { se.Score, se.Reason = 1, r.ID }
+        }
+        if se.Score == 1 { aligned++ }
+        ev.Steps = append(ev.Steps, se)
+    }
+    for _, r := range p.PlanRules { apply(r, env, "") }
+    ev.Coverage = float64(aligned) / float64(len(apa.Steps))
+    if ev.Risk < 0 { ev.Risk = 0 }
+    if ev.Risk > 1 { ev.Risk = 1 }
+    for o := range obligations { ev.Obligations = append(ev.Obligations, o) }
+    slices.Sort(ev.Obligations)
+    return ev
+}
+
+// ExternalPolicyVerifier registers external-policy-v1 backed by a PolicyEngine.
+// A nil Engine evaluates DefaultPolicy for every profile.
+type ExternalPolicyVerifier struct{ Engine *PolicyEngine }
+
+func (ExternalPolicyVerifier) Method() string { return "external-policy-v1" }
+
+func (v ExternalPolicyVerifier) Verify(uia UIA, apa APA) APrEvidence {
+    return v.Engine.For(uia.PolicyProfile).Evaluate(uia, apa)
+}
 
 // ExternalPolicy encapsulates minimal policy inputs for external-policy-v1 verifier.
+//
+// Deprecated: write a Policy and use Policy.Evaluate.
 type ExternalPolicy struct {
     Keywords  []string `json:"keywords"`
     WriteRisk float64  `json:"writeRisk"`
 }
 
 // VerifyAlignmentExternalPolicy computes coverage/risk based on explicit policy keywords
-// and a fixed write risk contribution. This is a deterministic profile.
+// and a fixed write risk contribution. Coverage comes from evaluating the step
+// rules of DefaultPolicy with pol.Keywords as the purpose terms.
+//
+// Deprecated: use Policy.Evaluate.
 func VerifyAlignmentExternalPolicy(uia UIA, apa APA, pol ExternalPolicy) (coverage float64, risk float64) {
-    total := len(apa.Steps)
-    if total == 0 { return 0, 1 }
-    aligned := 0
+    if len(apa.Steps) == 0 { return 0, 1 }
     kws := make([]string, 0, len(pol.Keywords))
     for _, k := range pol.Keywords { if k != "" { kws = append(kws, strings.ToLower(k)) } }
-    for _, s := range apa.Steps {
-        if s.Tool == "ollama.generate" {
-            if p, ok := s.Args["prompt"].(string); ok && containsAny(strings.ToLower(p), kws) { aligned++ }
-        } else if s.Tool == "http.get" {
-            if u, ok := s.Args["url"].(string); ok && containsAny(strings.ToLower(u), kws) { aligned++ }
-        }
-    }
-    coverage = float64(aligned) / float64(total)
-    risk = 0
+    ev := (&Policy{StepRules: builtinPolicy.StepRules}).evaluate(uia, apa, kws)
     if apa.Totals.PredictedWrites > 0 { risk += pol.WriteRisk }
-    if risk < 0 { risk = 0 }
-    if risk > 1 { risk = 1 }
-    return
+    return ev.Coverage, min(max(risk, 0), 1)
 }
-
-
@@ -0,0 +1,95 @@
+package ais
+
+import (
+    "strings"
+    "unicode"
+)
+
+// Redaction obligations name a data class; the full forms are
+// "tokenize:<class>" and "mask:<class>".
+const (
+    // ObligationTokenize replaces values of the class with vault tokens that
+    // authorized roles can reverse.
+    ObligationTokenize = "tokenize:"
+    // ObligationMask replaces values of the class irreversibly.
+    ObligationMask = "mask:"
+)
+
+// RedactionReport counts the spans replaced per class, for the audit log.
+type RedactionReport struct {
+    Tokenized map[string]int `json:"tokenized,omitempty"`
+    Masked    map[string]int `json:"masked,omitempty"`
+}
+
+// Redactor applies the tokenize: and mask: obligations of an APr to a tool
+// result, finding values with Scanner's detectors. Masking wins when a class
+// is named by both.
+type Redactor struct {
+    Scanner *DLPScanner
+    Vault   *TokenVault
+}
+
+// Apply rewrites out per the obligations. Without a vault, tokenize falls
+// back to masking so values never pass through untokenized.
+func (r *Redactor) Apply(obligations []string, uiaRef, out string) (string, RedactionReport, error) {
+    tokenize, mask := map[string]bool{}, map[string]bool{}
+    for _, o := range obligations {
+        if c, ok := strings.CutPrefix(o, ObligationTokenize); ok && c != "" { tokenize[c] = true }
+        if c, ok := strings.CutPrefix(o, ObligationMask); ok && c != "" { mask[c] = true }
+    }
+    rep := RedactionReport{}
+    if len(tokenize) == 0 && len(mask) == 0 { return out, rep, nil }
+    scanner := r.Scanner
+    if scanner == nil { scanner = DefaultDLPScanner() }
+    var b strings.Builder
+    last := 0
+    for _, f := range scanner.Scan(out) {
+        value := out[f.Start:f.End]
+        var repl string
+        switch {
+        case mask[f.Class] || tokenize[f.Class] && r.Vault == nil:
+            repl = MaskValue(f.Detector, value)
+            if rep.Masked == nil { rep.Masked = map[string]int{} }
+            rep.Masked[f.Class]++
+        case tokenize[f.Class]:
+            tok, err := r.Vault.Tokenize(uiaRef, f.Class, value)
+            if err != nil { return "", rep, err }
+            repl = tok
+            if rep.Tokenized == nil { rep.Tokenized = map[string]int{} }
+            rep.Tokenized[f.Class]++
+        default:
+            continue
+        }
+        b.WriteString(out[last:f.Start])
+        b.WriteString(repl)
+        last = f.End
+    }
+    b.WriteString(out[last:])
+    return b.String(), rep, nil
+}
+
+// MaskValue hides a detected value, keeping only what helps a reader tell
+// values apart: an email's first character and domain, a card's last four
+// digits. Letters and digits become '*'; separators stay.
+func MaskValue(detector, value string) string {
+    keepFrom := len(value)
+    prefix := ""
+    switch detector {
+    case "email":
+        at := strings.LastIndexByte(value, '@')
+        if at > 0 { prefix, value, keepFrom = value[:1], value[1:], at-1 }
+    case "credit-card":
+        digits := 0
+        for i := len(value) - 1; i >= 0; i-- {
+            if value[i] >= '0' && value[i] <= '9' { digits++ }
+            if digits == 4 { keepFrom = i; break }
+        }
+    }
+    var b strings.Builder
+    b.WriteString(prefix)
+    for i, c := range value {
+        if i < keepFrom && (unicode.IsLetter(c) || unicode.IsDigit(c)) { c = '*' }
+        b.WriteRune(c)
+    }
+    return b.String()
+}
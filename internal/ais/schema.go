@@ -0,0 +1,146 @@
+package ais
+
+import (
+    "encoding/json"
+    "fmt"
+    "math"
+    "reflect"
+    "regexp"
+    "slices"
+    "unicode/utf8"
+)
+
+// ValidateSchema checks v (JSON-decoded) against the subset of JSON Schema
+// tool schemas use: type, properties, required, additionalProperties, items,
+// minItems/maxItems, enum, const, minLength/maxLength, pattern,
+// minimum/maximum and allOf/anyOf/oneOf. Other keywords, including $ref,
+// are ignored.
+func ValidateSchema(schema map[string]any, v any) error { return validateSchema(schema, normalizeJSON(v), "args") }
+
+func validateSchema(s map[string]any, v any, at string) error {
+    if t, ok := s["type"]; ok && !schemaTypeOK(t, v) { return fmt.Errorf("%s: want type %v", at, t) }
+    if e, ok := s["enum"].([]any); ok && !slices.ContainsFunc(e, func(x any) bool { return reflect.DeepEqual(normalizeJSON(x), v) }) {
+        return fmt.Errorf("%s: not one of %v", at, e)
+    }
+    if c, ok := s["const"]; ok && !reflect.DeepEqual(normalizeJSON(c), v) { return fmt.Errorf("%s: want %v", at, c) }
+    switch x := v.(type) {
+    case map[string]any:
+        props, _ := s["properties"].(map[string]any)
+        for _, r := range schemaStrings(s["required"]) {
+            if _, ok := x[r]; !ok { return fmt.Errorf("%s.%s: required", at, r) }
+        }
+        for k, val := range x {
+            if ps, ok := props[k].(map[string]any); ok {
+                if err := validateSchema(ps, val, at+"."+k); err != nil { return err }
+                continue
+            }
+            switch ap := s["additionalProperties"].(type) {
+            case bool:
+                if !ap { return fmt.Errorf("%s.%s: unexpected property", at, k) }
+            case map[string]any:
+                if err := validateSchema(ap, val, at+"."+k); err != nil { return err }
+            }
+        }
+    case []any:
+        if n, ok := schemaNumber(s["minItems"]); ok && float64(len(x)) < n { return fmt.Errorf("%s: fewer than %v items", at, n) }
+        if n, ok := schemaNumber(s["maxItems"]); ok && float64(len(x)) > n { return fmt.Errorf("%s: more than %v items", at, n) }
+        if is, ok := s["items"].(map[string]any); ok {
+            for i, item := range x {
+                if err := validateSchema(is, item, fmt.Sprintf("%s[%d]", at, i)); err != nil { return err }
+            }
+        }
+    case string:
+        n := float64(utf8.RuneCountInString(x))
+        if m, ok := schemaNumber(s["minLength"]); ok && n < m { return fmt.Errorf("%s: shorter than %v", at, m) }
+        if m, ok := schemaNumber(s["maxLength"]); ok && n > m { return fmt.Errorf("%s: longer than %v", at, m) }
+        if p, ok := s["pattern"].(string); ok {
+            re, err := regexp.Compile(p)
+            if err != nil || !re.MatchString(x) { return fmt.Errorf("%s: does not match %s", at, p) }
+        }
+    case float64:
+        if m, ok := schemaNumber(s["minimum"]); ok && x < m { return fmt.Errorf("%s: below %v", at, m) }
+        if m, ok := schemaNumber(s["maximum"]); ok && x > m { return fmt.Errorf("%s: above %v", at, m) }
+    }
+    for _, sub := range schemaList(s["allOf"]) {
+        if err := validateSchema(sub, v, at); err != nil { return err }
+    }
+    if subs := schemaList(s["anyOf"]); len(subs) > 0 && countMatches(subs, v, at) == 0 { return fmt.Errorf("%s: matches no anyOf schema", at) }
+    if subs := schemaList(s["oneOf"]); len(subs) > 0 && countMatches(subs, v, at) != 1 { return fmt.Errorf("%s: must match exactly one oneOf schema", at) }
+    return nil
+}
+
+func countMatches(subs []map[string]any, v any, at string) int {
+    n := 0
+    for _, sub := range subs { if validateSchema(sub, v, at) == nil { n++ } }
+    return n
+}
+
+func schemaTypeOK(t any, v any) bool {
+    for _, name := range schemaStrings(t) {
+        switch x := v.(type) {
+        case nil:
+            if name == "null" { return true }
+        case bool:
+            if name == "boolean" { return true }
+        case string:
+            if name == "string" { return true }
+        case float64:
+            if name == "number" || name == "integer" && x == math.Trunc(x) { return true }
+        case []any:
+            if name == "array" { return true }
+        case map[string]any:
+            if name == "object" { return true }
+        }
+    }
+    return false
+}
+
+// schemaStrings reads a string or list of strings ("type", "required").
+func schemaStrings(v any) []string {
+    switch x := v.(type) {
+    case string:
+        return []string{x}
+    case []string:
+        return x
+    case []any:
+        var out []string
+        for _, e := range x { if s, ok := e.(string); ok { out = append(out, s) } }
+        return out
+    }
+    return nil
+}
+
+func schemaList(v any) []map[string]any {
+    var out []map[string]any
+    switch x := v.(type) {
+    case []any:
+        for _, e := range x { if m, ok := e.(map[string]any); ok { out = append(out, m) } }
+    case []map[string]any:
+        out = x
+    }
+    return out
+}
+
+func schemaNumber(v any) (float64, bool) {
+    switch x := v.(type) {
+    case float64:
+        return x, true
+    case int:
+        return float64(x), true
+    }
+    return 0, false
+}
+
+// normalizeJSON round-trips Go values ([]string, int, structs) through JSON
+// so schemas and args built in code compare like decoded ones.
+func normalizeJSON(v any) any {
+    switch v.(type) {
+    case nil, bool, string, float64:
+        return v
+    }
+    b, err := json.Marshal(v)
+    if err != nil { return v }
+    var out any
+    if json.Unmarshal(b, &out) != nil { return v }
+    return out
+}
@@ -0,0 +1,40 @@
+package ais
+
+import "slices"
+
+// SemanticEntailmentV2Verifier is semantic-entailment-v2: semantic-entailment-v1
+// over the keywordsV2 pipeline. A step is aligned when its prompt or url
+// shares a token with the purpose; http.get steps are also aligned when the
+// purpose yields no tokens. Risk is v1's; obligations are DeriveObligations'.
+type SemanticEntailmentV2Verifier struct{}
+
+func (SemanticEntailmentV2Verifier) Method() string { return "semantic-entailment-v2" }
+
+func (SemanticEntailmentV2Verifier) Verify(uia UIA, apa APA) APrEvidence {
+    ev := APrEvidence{Risk: 1}
+    if len(apa.Steps) == 0 { return ev }
+    terms := keywordsV2(uia.Purpose)
+    aligned := 0
+    for _, s := range apa.Steps {
+        se := StepEvidence{Step: s.ID}
+        for _, t := range keywordsV2(stepRawText(s)) {
+            if slices.Contains(terms, t) && !slices.Contains(se.Matched, t) { se.Matched = append(se.Matched, t) }
+        }
+        switch {
+        case s.Tool != "ollama.generate" && s.Tool != "http.get":
+            se.Reason = "tool not covered by method"
+        case len(se.Matched) > 0:
+            se.Score, se.Reason = 1, "shares purpose tokens"
+        case s.Tool == "http.get" && len(terms) == 0:
+            se.Score, se.Reason = 1, "no purpose terms to match"
+        default:
+            se.Reason = "no purpose token shared"
+        }
+        if se.Score == 1 { aligned++ }
+        ev.Steps = append(ev.Steps, se)
+    }
+    ev.Coverage = float64(aligned) / float64(len(apa.Steps))
+    ev.Risk = planRisk(uia, apa)
+    ev.Obligations = DeriveObligations(uia, apa)
+    return ev
+}
@@ -0,0 +1,269 @@
+package ais
+
+import (
+    "context"
+    "crypto/sha256"
+    "database/sql"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/url"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// SQL tool defaults.
+const (
+    DefaultSQLTimeout = 5 * time.Second
+    DefaultSQLMaxRows = 100
+)
+
+// ErrRecordsExceeded is returned when a query runs with no records left in
+// the UIA's budget.
+var ErrRecordsExceeded = errors.New("RISK-RECORDS-EXCEEDED")
+
+// SQLTool is sql.query: runs a single SELECT against DB and returns at most
+// MaxRows rows (fewer if the context carries a smaller record limit). Columns
+// labels "table.column" (or "table.*") with data classes, declared in the TCA;
+// a query is labelled with every labelled column it names, and with all of a
+// table's labelled columns when it selects "*" from it. Unlabelled data gets
+// DefaultLabels. Open DB read-only (see SQLiteReadOnlyDSN); the statement
+// allowlist is a policy check, not the only line of defence.
+type SQLTool struct {
+    DB            *sql.DB
+    Columns       map[string][]string
+    DefaultLabels []string
+    MaxRows       int
+    Timeout       time.Duration
+}
+
+// SQLiteReadOnlyDSN opens path read-only with writes refused per connection,
+// in the URI form understood by the pure-Go modernc.org/sqlite driver.
+func SQLiteReadOnlyDSN(path string) string {
+    return "file:" + (&url.URL{Path: path}).EscapedPath() + "?mode=ro&_pragma=query_only(1)"
+}
+
+func (SQLTool) Name() string { return "sql.query" }
+
+// TCA declares a read-only operation over the labelled columns.
+func (t SQLTool) TCA() TCA {
+    classes := append([]string{}, t.DefaultLabels...)
+    for _, l := range t.Columns { classes = append(classes, l...) }
+    sort.Strings(classes)
+    return TCA{ID: "urn:tca:sql.query@1", Operator: "local", Operations: []TCAOperation{{Name: "sql.query", Effects: OperationEffects{Writes: 0, DataClasses: dedupeSorted(classes), Columns: t.Columns}}}}
+}
+
+func (SQLTool) InputSchema() map[string]any {
+    return map[string]any{"type": "object", "properties": map[string]any{
+        "query":  map[string]any{"type": "string", "minLength": 1, "description": "a single SELECT statement"},
+        "params": map[string]any{"type": "array", "items": map[string]any{"type": []string{"string", "number", "boolean", "null"}}},
+    }, "required": []string{"query"}}
+}
+
+func (SQLTool) ValidateArgs(args map[string]any) error {
+    q, ok := args["query"].(string)
+    if !ok || strings.TrimSpace(q) == "" { return errors.New("query must be a non-empty string") }
+    if _, err := sqlParams(args); err != nil { return err }
+    toks, err := sqlTokenize(q)
+    if err != nil { return err }
+    _, err = checkSelect(toks)
+    return err
+}
+
+// LabelArgs returns the labels of the columns the query names.
+func (t SQLTool) LabelArgs(args map[string]any) ([]string, error) {
+    q, _ := args["query"].(string)
+    toks, err := sqlTokenize(q)
+    if err != nil { return nil, err }
+    return t.labels(toks), nil
+}
+
+func (t SQLTool) labels(toks []sqlToken) []string {
+    names, star := map[string]bool{}, false
+    for _, tk := range toks {
+        switch {
+        case tk.kind == sqlWord || tk.kind == sqlIdent:
+            names[tk.text] = true
+        case tk.kind == sqlPunct && tk.text == "*":
+            star = true
+        }
+    }
+    out := append([]string{}, t.DefaultLabels...)
+    for key, l := range t.Columns {
+        table, col, ok := strings.Cut(strings.ToLower(key), ".")
+        if !ok { continue }
+        if col == "*" && names[table] || col != "*" && (names[col] || star && names[table]) { out = append(out, l...) }
+    }
+    sort.Strings(out)
+    return dedupeSorted(out)
+}
+
+func (t SQLTool) Invoke(ctx context.Context, args map[string]any) (Result, error) {
+    if err := t.ValidateArgs(args); err != nil { return Result{}, err }
+    if t.DB == nil { return Result{}, errors.New("sql.query: no database configured") }
+    toks, _ := sqlTokenize(args["query"].(string))
+    end, _ := checkSelect(toks)
+    params, _ := sqlParams(args)
+    limit := t.MaxRows
+    if limit <= 0 { limit = DefaultSQLMaxRows }
+    if n, ok := RecordLimitFrom(ctx); ok && n < limit { limit = n }
+    if limit <= 0 { return Result{}, ErrRecordsExceeded }
+    timeout := t.Timeout
+    if timeout <= 0 { timeout = DefaultSQLTimeout }
+    ctx, cancel := context.WithTimeout(ctx, timeout)
+    defer cancel()
+
+    // the query is wrapped so the database stops one row past the limit; the
+    // newlines keep a trailing line comment from swallowing the wrapper
+    q := "SELECT * FROM (\n" + args["query"].(string)[:end] + "\n) LIMIT " + strconv.Itoa(limit+1)
+    rows, err := t.DB.QueryContext(ctx, q, params...)
+    if err != nil { return Result{}, fmt.Errorf("sql.query: %w", err) }
+    defer rows.Close()
+    cols, err := rows.Columns()
+    if err != nil { return Result{}, fmt.Errorf("sql.query: %w", err) }
+    out := [][]any{}
+    truncated := false
+    for rows.Next() {
+        if len(out) == limit { truncated = true; break }
+        vals := make([]any, len(cols))
+        ptrs := make([]any, len(cols))
+        for i := range vals { ptrs[i] = &vals[i] }
+        if err := rows.Scan(ptrs...); err != nil { return Result{}, fmt.Errorf("sql.query: %w", err) }
+        for i, v := range vals {
+            if b, ok := v.([]byte); ok { vals[i] = string(b) }
+        }
+        out = append(out, vals)
+    }
+    if err := rows.Err(); err != nil { return Result{}, fmt.Errorf("sql.query: %w", err) }
+    b, err := json.Marshal(map[string]any{"columns": cols, "rows": out})
+    if err != nil { return Result{}, err }
+    sum := sha256.Sum256(b)
+    return Result{Output: string(b), Records: len(out), Meta: map[string]any{"columns": cols, "rows": len(out), "truncated": truncated, "labels": t.labels(toks), "bodyHash": "sha256:" + hex.EncodeToString(sum[:])}}, nil
+}
+
+// sqlParams returns args["params"], which must be a list of scalars.
+func sqlParams(args map[string]any) ([]any, error) {
+    raw, ok := args["params"]
+    if !ok || raw == nil { return nil, nil }
+    list, ok := raw.([]any)
+    if !ok { return nil, errors.New("params must be a list") }
+    for _, p := range list {
+        switch p.(type) {
+        case nil, string, float64, int, int64, bool:
+        default:
+            return nil, errors.New("params must be strings, numbers, booleans or null")
+        }
+    }
+    return list, nil
+}
+
+type sqlTokenKind int
+
+const (
+    sqlWord  sqlTokenKind = iota // bare identifier or keyword, lowercased
+    sqlIdent                     // quoted identifier, unquoted and lowercased
+    sqlString
+    sqlNumber
+    sqlParam
+    sqlPunct
+)
+
+type sqlToken struct {
+    kind sqlTokenKind
+    text string
+    end  int // byte offset just past the token
+}
+
+// sqlTokenize splits a SQLite statement into tokens, dropping comments.
+func sqlTokenize(q string) ([]sqlToken, error) {
+    var out []sqlToken
+    for i := 0; i < len(q); {
+        c := q[i]
+        switch {
+        case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+            i++
+        case strings.HasPrefix(q[i:], "--"):
+            for i < len(q) && q[i] != '\n' { i++ }
+        case strings.HasPrefix(q[i:], "/*"):
+            j := strings.Index(q[i+2:], "*/")
+            if j < 0 { return nil, errors.New("unterminated comment") }
+            i += j + 4
+        case c == '\'' || c == '"' || c == '`' || c == '[':
+            closer := c
+            if c == '[' { closer = ']' }
+            j := i + 1
+            var b strings.Builder
+            for {
+                if j >= len(q) { return nil, errors.New("unterminated quote") }
+                if q[j] == closer {
+                    // a doubled quote is an escaped quote, except in [brackets]
+                    if closer != ']' && j+1 < len(q) && q[j+1] == closer { b.WriteByte(closer); j += 2; continue }
+                    break
+                }
+                b.WriteByte(q[j])
+                j++
+            }
+            kind := sqlIdent
+            if c == '\'' { kind = sqlString }
+            text := b.String()
+            if kind == sqlIdent { text = strings.ToLower(text) }
+            i = j + 1
+            out = append(out, sqlToken{kind, text, i})
+        case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80:
+            j := i
+            for j < len(q) && (q[j] == '_' || q[j] == '$' || q[j] >= 'a' && q[j] <= 'z' || q[j] >= 'A' && q[j] <= 'Z' || q[j] >= '0' && q[j] <= '9' || q[j] >= 0x80) { j++ }
+            out = append(out, sqlToken{sqlWord, strings.ToLower(q[i:j]), j})
+            i = j
+        case c >= '0' && c <= '9' || c == '.' && i+1 < len(q) && q[i+1] >= '0' && q[i+1] <= '9':
+            j := i + 1
+            for j < len(q) && (q[j] == '.' || q[j] == '_' || q[j] >= '0' && q[j] <= '9' || q[j] >= 'a' && q[j] <= 'z' || q[j] >= 'A' && q[j] <= 'Z') { j++ }
+            out = append(out, sqlToken{sqlNumber, q[i:j], j})
+            i = j
+        case c == '?' || c == ':' || c == '@' || c == '$':
+            j := i + 1
+            for j < len(q) && (q[j] == '_' || q[j] >= 'a' && q[j] <= 'z' || q[j] >= 'A' && q[j] <= 'Z' || q[j] >= '0' && q[j] <= '9') { j++ }
+            out = append(out, sqlToken{sqlParam, q[i:j], j})
+            i = j
+        default:
+            out = append(out, sqlToken{sqlPunct, string(c), i + 1})
+            i++
+        }
+    }
+    return out, nil
+}
+
+// sqlDenied are keywords and functions a sql.query statement may not use.
+var sqlDenied = map[string]bool{
+    "insert": true, "update": true, "delete": true, "create": true, "drop": true, "alter": true,
+    "attach": true, "detach": true, "pragma": true, "vacuum": true, "reindex": true, "analyze": true,
+    "begin": true, "commit": true, "rollback": true, "savepoint": true, "release": true,
+    "load_extension": true, "readfile": true, "writefile": true, "edit": true, "fts3_tokenizer": true,
+}
+
+// checkSelect allows exactly one SELECT (optionally behind a WITH clause)
+// and returns the byte offset where the statement ends, before any trailing
+// semicolons and comments.
+func checkSelect(toks []sqlToken) (int, error) {
+    for len(toks) > 0 && toks[len(toks)-1].kind == sqlPunct && toks[len(toks)-1].text == ";" { toks = toks[:len(toks)-1] }
+    if len(toks) == 0 { return 0, errors.New("query is empty") }
+    if first := toks[0]; first.kind != sqlWord || first.text != "select" && first.text != "with" { return 0, errors.New("only SELECT statements are allowed") }
+    for i, tk := range toks {
+        if tk.kind == sqlPunct && tk.text == ";" { return 0, errors.New("only one statement is allowed") }
+        if tk.kind != sqlWord { continue }
+        if sqlDenied[tk.text] { return 0, fmt.Errorf("%s is not allowed in a query", strings.ToUpper(tk.text)) }
+        // replace() is a function; REPLACE INTO is a write
+        if tk.text == "replace" && i+1 < len(toks) && toks[i+1].kind == sqlWord && toks[i+1].text == "into" { return 0, errors.New("REPLACE is not allowed in a query") }
+    }
+    return toks[len(toks)-1].end, nil
+}
+
+func dedupeSorted(s []string) []string {
+    out := s[:0]
+    for i, v := range s {
+        if i == 0 || v != s[i-1] { out = append(out, v) }
+    }
+    return out
+}
@@ -0,0 +1,155 @@
+package ais
+
+import (
+    "strings"
+    "unicode"
+)
+
+// keywordsV2 is the tokenization pipeline pinned by semantic-entailment-v2:
+//  1. Unicode word segmentation: runs of letters, marks and digits. Han runs
+//     become character bigrams, Katakana runs are kept whole and Hiragana
+//     (particles, inflections) is dropped.
+//  2. Lowercasing and language detection (en, de, fr) by stopword hits.
+//  3. Stopword removal for the detected language plus URL noise words.
+//  4. A light suffix stemmer for that language; words under 3 runes are dropped.
+// Changing any step requires a new method version so APr vectors stay valid.
+func keywordsV2(text string) []string {
+    words, cjk := segmentV2(strings.ToLower(text))
+    lang := detectLang(words)
+    out := make([]string, 0, len(words)+len(cjk))
+    seen := map[string]bool{}
+    add := func(t string) {
+        if t == "" || seen[t] { return }
+        seen[t] = true
+        out = append(out, t)
+    }
+    for _, w := range words {
+        if stopwords[lang][w] || urlNoise[w] || isNumber(w) { continue }
+        if s := stemV2(lang, w); len([]rune(s)) >= 3 { add(s) }
+    }
+    for _, t := range cjk { add(t) }
+    return out
+}
+
+// segmentV2 splits text into alphabetic words and CJK tokens.
+func segmentV2(text string) (words, cjk []string) {
+    var word []rune
+    var run []rune
+    var runScript *unicode.RangeTable
+    flushWord := func() {
+        if len(word) > 0 { words = append(words, string(word)) }
+        word = word[:0]
+    }
+    flushRun := func() {
+        switch {
+        case runScript == unicode.Han && len(run) == 1:
+            cjk = append(cjk, string(run))
+        case runScript == unicode.Han:
+            for i := 0; i+1 < len(run); i++ { cjk = append(cjk, string(run[i:i+2])) }
+        case runScript == unicode.Katakana && len(run) > 0:
+            cjk = append(cjk, string(run))
+        }
+        run, runScript = run[:0], nil
+    }
+    for _, r := range text {
+        script := cjkScript(r)
+        if script != nil {
+            flushWord()
+            if script != runScript { flushRun(); runScript = script }
+            run = append(run, r)
+            continue
+        }
+        flushRun()
+        if unicode.IsLetter(r) || unicode.IsMark(r) || unicode.IsDigit(r) {
+            word = append(word, r)
+        } else {
+            flushWord()
+        }
+    }
+    flushWord()
+    flushRun()
+    return words, cjk
+}
+
+func cjkScript(r rune) *unicode.RangeTable {
+    switch {
+    case unicode.Is(unicode.Han, r):
+        return unicode.Han
+    case unicode.Is(unicode.Katakana, r) || r == 'ー':
+        return unicode.Katakana
+    case unicode.Is(unicode.Hiragana, r):
+        return unicode.Hiragana
+    }
+    return nil
+}
+
+func isNumber(w string) bool {
+    for _, r := range w { if !unicode.IsDigit(r) { return false } }
+    return true
+}
+
+// detectLang picks the language whose stopword list matches most words,
+// preferring en on ties.
+func detectLang(words []string) string {
+    best, bestHits := "en", 0
+    for _, lang := range []string{"en", "de", "fr"} {
+        hits := 0
+        for _, w := range words { if stopwords[lang][w] { hits++ } }
+        if hits > bestHits { best, bestHits = lang, hits }
+    }
+    return best
+}
+
+// stemV2 strips common inflectional and derivational suffixes, keeping a stem
+// of at least 3 runes. de and fr words are folded to ASCII first.
+func stemV2(lang, w string) string {
+    switch lang {
+    case "de", "fr":
+        w = foldDiacritics(w)
+    }
+    strip := func(w string, suffixes ...string) string {
+        for _, s := range suffixes {
+            if strings.HasSuffix(w, s) && len([]rune(w))-len([]rune(s)) >= 3 { return strings.TrimSuffix(w, s) }
+        }
+        return w
+    }
+    switch lang {
+    case "de":
+        return strip(w, "ern", "em", "en", "er", "es", "e", "s")
+    case "fr":
+        return strip(w, "ations", "ation", "ements", "ement", "euses", "euse", "eux", "ees", "ee", "es", "er", "ez", "e", "s", "x")
+    }
+    // en: plural first, then one derivational or inflectional suffix
+    switch {
+    case strings.HasSuffix(w, "ies") && len(w) > 4:
+        w = strings.TrimSuffix(w, "ies") + "y"
+    case strings.HasSuffix(w, "sses"):
+        w = strings.TrimSuffix(w, "es")
+    case strings.HasSuffix(w, "s") && !strings.HasSuffix(w, "ss") && !strings.HasSuffix(w, "us") && !strings.HasSuffix(w, "is"):
+        w = strip(w, "s")
+    }
+    return strip(w, "ization", "isation", "ation", "izing", "ising", "ized", "ised", "ize", "ise", "ment", "ness", "ing", "ed", "ly", "er", "y")
+}
+
+var diacritics = strings.NewReplacer(
+    "à", "a", "â", "a", "ä", "a", "á", "a", "ç", "c", "é", "e", "è", "e", "ê", "e", "ë", "e",
+    "î", "i", "ï", "i", "í", "i", "ô", "o", "ö", "o", "ó", "o", "ù", "u", "û", "u", "ü", "u", "ú", "u",
+    "ÿ", "y", "œ", "oe", "æ", "ae", "ß", "ss",
+)
+
+func foldDiacritics(w string) string { return diacritics.Replace(w) }
+
+func wordSet(ws ...string) map[string]bool {
+    m := make(map[string]bool, len(ws))
+    for _, w := range ws { m[w] = true }
+    return m
+}
+
+// urlNoise drops scheme and host boilerplate from tokenized URLs.
+var urlNoise = wordSet("http", "https", "www", "com", "org", "net", "html", "htm", "php", "index")
+
+var stopwords = map[string]map[string]bool{
+    "en": wordSet("a", "about", "above", "after", "again", "all", "also", "an", "and", "any", "are", "as", "at", "be", "been", "before", "being", "below", "between", "both", "but", "by", "can", "could", "did", "do", "does", "doing", "down", "during", "each", "few", "for", "from", "further", "had", "has", "have", "having", "he", "her", "here", "hers", "him", "his", "how", "i", "if", "in", "into", "is", "it", "its", "just", "me", "more", "most", "my", "no", "nor", "not", "now", "of", "off", "on", "once", "only", "or", "other", "our", "ours", "out", "over", "own", "please", "same", "she", "should", "so", "some", "such", "than", "that", "the", "their", "theirs", "them", "then", "there", "these", "they", "this", "those", "through", "to", "too", "under", "until", "up", "very", "was", "we", "were", "what", "when", "where", "which", "while", "who", "whom", "why", "will", "with", "would", "you", "your", "yours"),
+    "de": wordSet("aber", "alle", "als", "also", "am", "an", "auch", "auf", "aus", "bei", "bin", "bis", "bitte", "da", "damit", "dann", "das", "dass", "dem", "den", "der", "des", "die", "dies", "diese", "diesem", "diesen", "dieser", "doch", "du", "durch", "ein", "eine", "einem", "einen", "einer", "eines", "er", "es", "für", "hat", "haben", "ich", "ihr", "im", "in", "ist", "ja", "kann", "mit", "nach", "nicht", "noch", "nur", "oder", "sein", "sie", "sind", "so", "über", "um", "und", "uns", "unter", "vom", "von", "vor", "war", "was", "wenn", "werden", "wie", "wir", "wird", "zu", "zum", "zur"),
+    "fr": wordSet("à", "au", "aux", "avec", "ce", "ces", "cette", "dans", "de", "des", "du", "elle", "en", "est", "et", "eux", "il", "ils", "je", "la", "le", "les", "leur", "lui", "ma", "mais", "me", "mes", "moi", "mon", "ne", "nos", "notre", "nous", "on", "ou", "par", "pas", "pour", "qu", "que", "qui", "sa", "se", "ses", "son", "sur", "ta", "te", "tes", "toi", "ton", "tu", "un", "une", "vos", "votre", "vous", "l", "d", "s", "c", "j", "n", "m", "t", "y", "été", "être", "sont", "fait", "faire", "plus", "très"),
+}
@@ -0,0 +1,180 @@
+package ais
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "fmt"
+    "sort"
+    "sync"
+)
+
+// Result is a tool invocation's output. Meta carries tool-specific details
+// (status codes, hashes) for audit; it is never shown to the model. Writes
+// and Records are the effects actually performed, charged to the UIA's
+// Ledger.
+type Result struct {
+    Output  string         `json:"output"`
+    Meta    map[string]any `json:"meta,omitempty"`
+    Writes  int            `json:"writes,omitempty"`
+    Records int            `json:"records,omitempty"`
+}
+
+// Tool is an executor bound to the TCA that describes it. Name is the APA step
+// tool and must be one of the TCA's operations. A tool that may have written
+// before it failed returns the writes to charge along with its error; callers
+// settle that Result either way.
+type Tool interface {
+    Name() string
+    TCA() TCA
+    Invoke(ctx context.Context, args map[string]any) (Result, error)
+}
+
+// ArgValidator is implemented by tools that check step args; the guard rejects
+// invalid args with INPUT-SCHEMA-INVALID before the tool is invoked.
+type ArgValidator interface {
+    ValidateArgs(args map[string]any) error
+}
+
+// ArgLabeler is implemented by tools whose args select data with its own
+// labels (files, tables). The guard requires every label to be among the
+// UIA's dataClasses.
+type ArgLabeler interface {
+    LabelArgs(args map[string]any) ([]string, error)
+}
+
+// DestinationArgs is implemented by tools whose args name destinations other
+// than a "url" (e.g. mail recipients as "mailto:" URLs). The guard checks each
+// against the operation's declared destinations.
+type DestinationArgs interface {
+    ArgDestinations(args map[string]any) []string
+}
+
+// ArgSchema is implemented by tools that describe their args as a JSON
+// Schema, e.g. for MCP tools/list.
+type ArgSchema interface {
+    InputSchema() map[string]any
+}
+
+// InputSchema returns t's arg schema, or an open object schema.
+func InputSchema(t Tool) map[string]any {
+    if s, ok := t.(ArgSchema); ok { return s.InputSchema() }
+    return map[string]any{"type": "object"}
+}
+
+// ErrModelNotPresent is returned by model-backed tools while the model is
+// still being pulled.
+var ErrModelNotPresent = errors.New("MODEL-NOT-PRESENT")
+
+// ToolRegistry maps tool names to executors and tcaRefs to their TCAs. Tools
+// may share a TCA as long as they all return the same one.
+type ToolRegistry struct {
+    mu     sync.RWMutex
+    byName map[string]Tool
+    byRef  map[string]TCA
+}
+
+func NewToolRegistry(tools ...Tool) (*ToolRegistry, error) {
+    r := &ToolRegistry{byName: map[string]Tool{}, byRef: map[string]TCA{}}
+    for _, t := range tools {
+        if err := r.Register(t); err != nil { return nil, err }
+    }
+    return r, nil
+}
+
+// Register adds a tool. It fails if the name is taken, the tool is not an
+// operation of its own TCA, or another tool registered a different TCA under
+// the same id.
+func (r *ToolRegistry) Register(t Tool) error {
+    tca := t.TCA()
+    if tca.ID == "" { return fmt.Errorf("tool %s: TCA has no id", t.Name()) }
+    if _, ok := tcaOperation(tca, t.Name()); !ok { return fmt.Errorf("tool %s: not an operation of %s", t.Name(), tca.ID) }
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if _, dup := r.byName[t.Name()]; dup { return fmt.Errorf("tool %s already registered", t.Name()) }
+    if prev, ok := r.byRef[tca.ID]; ok && !sameTCA(prev, tca) { return fmt.Errorf("tool %s: conflicting TCA %s", t.Name(), tca.ID) }
+    r.byName[t.Name()] = t
+    r.byRef[tca.ID] = tca
+    return nil
+}
+
+// Lookup returns the tool registered under name.
+func (r *ToolRegistry) Lookup(name string) (Tool, bool) {
+    if r == nil { return nil, false }
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+    t, ok := r.byName[name]
+    return t, ok
+}
+
+// LookupTCA returns the TCA registered under ref.
+func (r *ToolRegistry) LookupTCA(ref string) (TCA, bool) {
+    if r == nil { return TCA{}, false }
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+    tca, ok := r.byRef[ref]
+    return tca, ok
+}
+
+// Tools lists registered tool names, sorted.
+func (r *ToolRegistry) Tools() []string {
+    if r == nil { return nil }
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+    out := make([]string, 0, len(r.byName))
+    for n := range r.byName { out = append(out, n) }
+    sort.Strings(out)
+    return out
+}
+
+// TCAs lists the registered TCAs, sorted by id.
+func (r *ToolRegistry) TCAs() []TCA {
+    if r == nil { return nil }
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+    out := make([]TCA, 0, len(r.byRef))
+    for _, t := range r.byRef { out = append(out, t) }
+    sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+    return out
+}
+
+func tcaOperation(tca TCA, name string) (*TCAOperation, bool) {
+    for i := range tca.Operations {
+        if tca.Operations[i].Name == name { return &tca.Operations[i], true }
+    }
+    return nil, false
+}
+
+func sameTCA(a, b TCA) bool {
+    ja, err1 := marshalCanonical(a)
+    jb, err2 := marshalCanonical(b)
+    return err1 == nil && err2 == nil && bytes.Equal(ja, jb)
+}
+
+type obligationsKey struct{}
+
+// WithObligations attaches APr obligations to ctx so tools can honour the
+// ones that constrain execution (e.g. no-followup-http).
+func WithObligations(ctx context.Context, obligations []string) context.Context {
+    return context.WithValue(ctx, obligationsKey{}, obligations)
+}
+
+// ObligationsFrom returns the obligations attached by WithObligations.
+func ObligationsFrom(ctx context.Context) []string {
+    o, _ := ctx.Value(obligationsKey{}).([]string)
+    return o
+}
+
+type recordLimitKey struct{}
+
+// WithRecordLimit attaches the records left in the UIA's budget to ctx so
+// record-returning tools can stop short of it.
+func WithRecordLimit(ctx context.Context, n int) context.Context {
+    return context.WithValue(ctx, recordLimitKey{}, n)
+}
+
+// RecordLimitFrom returns the limit attached by WithRecordLimit.
+func RecordLimitFrom(ctx context.Context) (int, bool) {
+    n, ok := ctx.Value(recordLimitKey{}).(int)
+    return n, ok
+}
@@ -1,6 +1,9 @@
 package ais
 
-import "time"
+import (
+    "regexp"
+    "time"
+)
 
 type UIA struct {
 	Type          string       `json:"@type"`
@@ -52,6 +55,13 @@ type APAStep struct {
 	Args     map[string]any `json:"args"`
 	Expected StepExpected   `json:"expected"`
 	Alignment StepAlignment `json:"alignment"`
+	// After lists earlier steps that must settle before this one; steps
+	// referenced in Args or When are dependencies too.
+	After    []string       `json:"after,omitempty"`
+	// When guards the step with an expression over earlier results
+	// (steps.<id>.output, steps.<id>.json, steps.<id>.skipped); a false
+	// guard skips it. Alternatives are steps with exclusive guards.
+	When     string         `json:"when,omitempty"`
 }
 
 type StepExpected struct {
@@ -79,8 +89,31 @@ type APr struct {
 }
 
 type APrEvidence struct {
-    Coverage float64 `json:"coverage"`
-    Risk     float64 `json:"risk"`
+    Coverage    float64        `json:"coverage"`
+    Risk        float64        `json:"risk"`
+    Steps       []StepEvidence `json:"steps,omitempty"`
+    Obligations []string       `json:"obligations,omitempty"`
+    // Model and ModelDigest pin the model behind model-backed methods so
+    // recomputation is deterministic.
+    Model       string         `json:"model,omitempty"`
+    ModelDigest string         `json:"modelDigest,omitempty"`
+    // PromptHash pins the prompt template of LLM-judged methods.
+    PromptHash  string         `json:"promptHash,omitempty"`
+    // PolicyDigest pins the policy file behind external-policy-v1; Denials
+    // are the deny reasons of its rules.
+    PolicyDigest string        `json:"policyDigest,omitempty"`
+    Denials     []string       `json:"denials,omitempty"`
+    // Rule and Components describe how an ensemble combined its sub-methods.
+    Rule        string              `json:"rule,omitempty"`
+    Components  []ComponentEvidence `json:"components,omitempty"`
+}
+
+// StepEvidence is the per-step alignment result behind an APr.
+type StepEvidence struct {
+    Step    string   `json:"step"`
+    Score   float64  `json:"score"`
+    Matched []string `json:"matched,omitempty"`
+    Reason  string   `json:"reason,omitempty"`
 }
 
 type IBE struct {
@@ -104,18 +137,58 @@ type TCA struct {
 type TCAOperation struct {
     Name    string           `json:"name"`
     Effects OperationEffects `json:"effects"`
+    // ArgsSchema, if set, is the JSON Schema the guard checks step args against.
+    ArgsSchema map[string]any `json:"argsSchema,omitempty"`
 }
 type OperationEffects struct {
     Writes      int      `json:"writes"`
     DataClasses []string `json:"dataClasses"`
     Destinations []string `json:"destinations,omitempty"`
-}
-
+    // Roots and Globs scope filesystem tools to directories and file patterns.
+    Roots        []string `json:"roots,omitempty"`
+    Globs        []string `json:"globs,omitempty"`
+    // Columns labels database columns ("table.column", "table.*") with data classes.
+    Columns      map[string][]string `json:"columns,omitempty"`
+    // Exec bounds subprocess tools: what may run, where, and with which limits.
+    Exec         *ExecEffects `json:"exec,omitempty"`
+}
+
+// ExecEffects declares what exec.run may run: allowlisted commands and their
+// argument patterns, a fixed working directory, the environment variables
+// passed through, resource limits, and whether the network is reachable.
+type ExecEffects struct {
+    Commands       []ExecCommand `json:"commands"`
+    Dir            string        `json:"dir"`
+    Env            []string      `json:"env,omitempty"`
+    TimeoutMs      int           `json:"timeoutMs"`
+    CPUSeconds     int           `json:"cpuSeconds"`
+    MaxMemoryBytes int64         `json:"maxMemoryBytes,omitempty"`
+    MaxOutputBytes int64         `json:"maxOutputBytes"`
+    Network        bool          `json:"network"`
+}
+
+// ExecCommand is an allowlisted binary. Every argument must fully match one
+// of the Args regular expressions.
+type ExecCommand struct {
+    Name    string   `json:"name"`
+    Path    string   `json:"path"`
+    Args    []string `json:"args"`
+    MaxArgs int      `json:"maxArgs,omitempty"`
+    // patterns are Args compiled and anchored by NewExecTool
+    patterns []*regexp.Regexp
+}
+
+// ConsentToken approves one step of one plan: the APA, the step and its
+// planned args (ArgsHash, see ConsentArgsHash) are all signed.
 type ConsentToken struct {
-    UIARef  string    `json:"uiaRef"`
-    StepRef string    `json:"stepRef"`
-    Exp     time.Time `json:"exp"`
-    Sig     string    `json:"sig"`
+    UIARef   string    `json:"uiaRef"`
+    APARef   string    `json:"apaRef"`
+    StepRef  string    `json:"stepRef"`
+    ArgsHash string    `json:"argsHash"`
+    Approver string    `json:"approver,omitempty"`
+    Exp      time.Time `json:"exp"`
+    Sig      string    `json:"sig"`
+    CoSig    string    `json:"coSig,omitempty"`
 }
 
 
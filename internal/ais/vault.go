@@ -0,0 +1,123 @@
+package ais
+
+import (
+    "bufio"
+    "crypto/aes"
+    "crypto/cipher"
+    "crypto/hmac"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "os"
+    "regexp"
+    "sync"
+    "time"
+)
+
+// ErrTokenUnknown is returned for tokens the vault did not issue.
+var ErrTokenUnknown = errors.New("TOKEN-UNKNOWN")
+
+// TokenPattern matches vault tokens in text: tok_<class>_<16 hex>.
+var TokenPattern = regexp.MustCompile(`\btok_[a-z0-9-]+_[0-9a-f]{16}\b`)
+
+// TokenEntry is a vault record. Value is only set on entries returned by
+// Detokenize; at rest it is sealed with AES-GCM.
+type TokenEntry struct {
+    Token   string    `json:"token"`
+    Class   string    `json:"class"`
+    UIA     string    `json:"uia"`
+    Created time.Time `json:"created"`
+    Value   string    `json:"value,omitempty"`
+    Sealed  string    `json:"sealed,omitempty"`
+}
+
+// TokenVault issues reversible tokens for sensitive values. Tokens are an
+// HMAC of the UIA, class and value, so a value maps to one token per intent
+// and tokens of different intents cannot be joined. With a path, entries are
+// appended to a JSONL file and reloaded on open.
+type TokenVault struct {
+    mu      sync.Mutex
+    path    string
+    macKey  []byte
+    aead    cipher.AEAD
+    entries map[string]TokenEntry
+}
+
+// OpenTokenVault opens (or creates) the vault at path, or an in-memory vault
+// when path is empty. Keys are derived from secret; a vault file only opens
+// with the secret it was written with.
+func OpenTokenVault(path string, secret []byte) (*TokenVault, error) {
+    mac := hmac.New(sha256.New, secret)
+    mac.Write([]byte("ais-vault-token"))
+    encKey := hmac.New(sha256.New, secret)
+    encKey.Write([]byte("ais-vault-seal"))
+    block, err := aes.NewCipher(encKey.Sum(nil))
+    if err != nil { return nil, err }
+    aead, err := cipher.NewGCM(block)
+    if err != nil { return nil, err }
+    v := &TokenVault{path: path, macKey: mac.Sum(nil), aead: aead, entries: map[string]TokenEntry{}}
+    if path == "" { return v, nil }
+    f, err := os.Open(path)
+    if errors.Is(err, os.ErrNotExist) { return v, nil }
+    if err != nil { return nil, err }
+    defer f.Close()
+    sc := bufio.NewScanner(f)
+    sc.Buffer(make([]byte, 64<<10), 1<<20)
+    for n := 1; sc.Scan(); n++ {
+        var e TokenEntry
+        if err := json.Unmarshal(sc.Bytes(), &e); err != nil { return nil, fmt.Errorf("%s:%d: %w", path, n, err) }
+        if _, err := v.open(e); err != nil { return nil, fmt.Errorf("%s:%d: %w", path, n, err) }
+        v.entries[e.Token] = e
+    }
+    return v, sc.Err()
+}
+
+// Tokenize returns the token for value, storing it on first use.
+func (v *TokenVault) Tokenize(uiaRef, class, value string) (string, error) {
+    m := hmac.New(sha256.New, v.macKey)
+    m.Write([]byte(uiaRef + "\x00" + class + "\x00" + value))
+    tok := "tok_" + class + "_" + hex.EncodeToString(m.Sum(nil))[:16]
+    v.mu.Lock()
+    defer v.mu.Unlock()
+    if _, ok := v.entries[tok]; ok { return tok, nil }
+    nonce := make([]byte, v.aead.NonceSize())
+    if _, err := rand.Read(nonce); err != nil { return "", err }
+    // the token is authenticated data, so a sealed value cannot be moved to another token
+    sealed := v.aead.Seal(nonce, nonce, []byte(value), []byte(tok))
+    e := TokenEntry{Token: tok, Class: class, UIA: uiaRef, Created: time.Now().UTC(), Sealed: base64.StdEncoding.EncodeToString(sealed)}
+    if v.path != "" {
+        f, err := os.OpenFile(v.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+        if err != nil { return "", err }
+        b, _ := json.Marshal(e)
+        _, err = f.Write(append(b, '\n'))
+        if cerr := f.Close(); err == nil { err = cerr }
+        if err != nil { return "", err }
+    }
+    v.entries[tok] = e
+    return tok, nil
+}
+
+// Detokenize returns the entry for token with its value.
+func (v *TokenVault) Detokenize(token string) (TokenEntry, error) {
+    v.mu.Lock()
+    e, ok := v.entries[token]
+    v.mu.Unlock()
+    if !ok { return TokenEntry{}, ErrTokenUnknown }
+    val, err := v.open(e)
+    if err != nil { return TokenEntry{}, err }
+    e.Value, e.Sealed = val, ""
+    return e, nil
+}
+
+func (v *TokenVault) open(e TokenEntry) (string, error) {
+    b, err := base64.StdEncoding.DecodeString(e.Sealed)
+    if err != nil || len(b) < v.aead.NonceSize() { return "", errors.New("vault: malformed entry") }
+    n := v.aead.NonceSize()
+    val, err := v.aead.Open(nil, b[:n], b[n:], []byte(e.Token))
+    if err != nil { return "", errors.New("vault: entry does not open with this secret") }
+    return string(val), nil
+}
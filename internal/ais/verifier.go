@@ -0,0 +1,137 @@
+package ais
+
+import (
+    "slices"
+    "sort"
+    "sync"
+)
+
+// AlignmentVerifier computes APr evidence for an APA against a UIA. Each
+// implementation is registered under its APr method id (spec/REGISTRIES.md)
+// and must be deterministic so the guard can recompute evidence.
+type AlignmentVerifier interface {
+    Method() string
+    Verify(uia UIA, apa APA) APrEvidence
+}
+
+var (
+    verifiers = struct{ sync.RWMutex; m map[string]AlignmentVerifier }{m: map[string]AlignmentVerifier{}}
+    // profileMethods lists the APr methods each policy profile accepts;
+    // profiles without an entry fall back to "default".
+    profileMethods = struct{ sync.RWMutex; m map[string][]string }{m: map[string][]string{
+        "default":           {"semantic-entailment-v1", "semantic-entailment-v1.1"},
+        "chat-readonly":     {"semantic-entailment-v1", "semantic-entailment-v1.1", "semantic-entailment-v2", "classifier-v1", "external-policy-v1", "embedding-cosine-v1", "llm-judge-v1", "ensemble-v1"},
+        "agent-readonly":    {"semantic-entailment-v1", "semantic-entailment-v1.1", "semantic-entailment-v2", "classifier-v1", "external-policy-v1", "embedding-cosine-v1", "llm-judge-v1", "ensemble-v1"},
+        "research-readonly": {"semantic-entailment-v1", "semantic-entailment-v1.1", "semantic-entailment-v2", "classifier-v1", "external-policy-v1", "embedding-cosine-v1", "llm-judge-v1", "ensemble-v1"},
+        "agent-outbox":      {"external-policy-v1"},
+    }}
+)
+
+func init() {
+    RegisterVerifier(SemanticEntailmentVerifier{})
+    RegisterVerifier(SemanticEntailmentV2Verifier{})
+    RegisterVerifier(SemanticEntailmentV11Verifier{})
+    RegisterVerifier(ClassifierVerifier{})
+    RegisterVerifier(ExternalPolicyVerifier{})
+    RegisterVerifier(EnsembleVerifier{Methods: []string{"semantic-entailment-v1.1", "semantic-entailment-v2", "classifier-v1", "external-policy-v1"}, Rule: EnsembleMin})
+}
+
+// SignedEvidenceTruster is implemented by verifiers whose recomputation is
+// expensive. For an APr whose proof verified, the guard uses the claimed
+// evidence instead of recomputing when TrustSigned approves it.
+type SignedEvidenceTruster interface {
+    TrustSigned(ev APrEvidence) bool
+}
+
+// StepThresholder is implemented by verifiers whose step scores are on their
+// own scale rather than 1 for an aligned step. The guard holds each step's
+// score to StepThreshold, the score at which the verifier itself counts the
+// step as aligned, instead of to the coverage threshold.
+type StepThresholder interface {
+    StepThreshold() float64
+}
+
+// RegisterVerifier adds or replaces the verifier for its method id.
+func RegisterVerifier(v AlignmentVerifier) {
+    verifiers.Lock()
+    verifiers.m[v.Method()] = v
+    verifiers.Unlock()
+}
+
+// LookupVerifier returns the verifier registered for an APr method id.
+func LookupVerifier(method string) (AlignmentVerifier, bool) {
+    verifiers.RLock()
+    defer verifiers.RUnlock()
+    v, ok := verifiers.m[method]
+    return v, ok
+}
+
+// RegisteredMethods returns the registered method ids in sorted order.
+func RegisteredMethods() []string {
+    verifiers.RLock()
+    defer verifiers.RUnlock()
+    out := make([]string, 0, len(verifiers.m))
+    for m := range verifiers.m { out = append(out, m) }
+    sort.Strings(out)
+    return out
+}
+
+// SetProfileMethods sets the APr methods a policy profile accepts.
+func SetProfileMethods(profile string, methods ...string) {
+    profileMethods.Lock()
+    profileMethods.m[profile] = append([]string(nil), methods...)
+    profileMethods.Unlock()
+}
+
+// MethodAllowed reports whether the policy profile accepts the APr method.
+func MethodAllowed(profile, method string) bool {
+    profileMethods.RLock()
+    defer profileMethods.RUnlock()
+    allowed, ok := profileMethods.m[profile]
+    if !ok { allowed = profileMethods.m["default"] }
+    return slices.Contains(allowed, method)
+}
+
+// evidenceMatches compares claimed evidence with a recomputation within the
+// ±1e-9 tolerance of the spec. Obligations and policy denials must match
+// exactly so they cannot be stripped; per-step scores are compared when the
+// claim carries them.
+func evidenceMatches(got, want APrEvidence) bool {
+    if abs(got.Coverage-want.Coverage) > 1e-9 || abs(got.Risk-want.Risk) > 1e-9 { return false }
+    if !slices.Equal(got.Obligations, want.Obligations) || !slices.Equal(got.Denials, want.Denials) { return false }
+    if got.Model != want.Model || got.ModelDigest != want.ModelDigest || got.PromptHash != want.PromptHash || got.PolicyDigest != want.PolicyDigest { return false }
+    for _, se := range got.Steps {
+        w, ok := stepEvidence(want, se.Step)
+        if !ok || abs(se.Score-w.Score) > 1e-9 { return false }
+    }
+    // Ensembles: every component must match its own recomputation
+    if got.Rule != want.Rule || len(got.Components) != len(want.Components) { return false }
+    for i := range got.Components {
+        if got.Components[i].Method != want.Components[i].Method || abs(got.Components[i].Weight-want.Components[i].Weight) > 1e-9 { return false }
+        if !evidenceMatches(got.Components[i].APrEvidence, want.Components[i].APrEvidence) { return false }
+    }
+    return true
+}
+
+// SemanticEntailmentVerifier is the reference semantic-entailment-v1 method.
+// Its evidence is coverage and risk only, so APrs issued under it keep
+// recomputing to the same evidence.
+type SemanticEntailmentVerifier struct{}
+
+func (SemanticEntailmentVerifier) Method() string { return "semantic-entailment-v1" }
+
+func (SemanticEntailmentVerifier) Verify(uia UIA, apa APA) APrEvidence {
+    cov, risk := VerifyAlignment(uia, apa)
+    return APrEvidence{Coverage: cov, Risk: risk}
+}
+
+// SemanticEntailmentV11Verifier is semantic-entailment-v1.1: v1's keyword
+// entailment with per-step scores and the plan's obligations in the evidence.
+type SemanticEntailmentV11Verifier struct{}
+
+func (SemanticEntailmentV11Verifier) Method() string { return "semantic-entailment-v1.1" }
+
+func (SemanticEntailmentV11Verifier) Verify(uia UIA, apa APA) APrEvidence {
+    cov, risk := VerifyAlignment(uia, apa)
+    return APrEvidence{Coverage: cov, Risk: risk, Steps: semanticStepEvidence(uia, apa), Obligations: DeriveObligations(uia, apa)}
+}
@@ -0,0 +1,140 @@
+package ais
+
+import (
+    "bytes"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "os"
+    "strconv"
+    "sync"
+    "time"
+)
+
+// WebhookEndpoint receives events whose type is listed in Events ("*" matches all).
+type WebhookEndpoint struct {
+    URL    string   `json:"url"`
+    Events []string `json:"events"`
+    Secret string   `json:"secret"`
+}
+
+// WebhookConfig is the on-disk dispatcher configuration. Delays use Go duration syntax.
+type WebhookConfig struct {
+    Endpoints  []WebhookEndpoint `json:"endpoints"`
+    MaxRetries int               `json:"maxRetries"`
+    BaseDelay  string            `json:"baseDelay"`
+    MaxDelay   string            `json:"maxDelay"`
+    Timeout    string            `json:"timeout"`
+    DeadLetter string            `json:"deadLetter"`
+}
+
+// WebhookDispatcher pushes HMAC-signed JSON events to configured endpoints,
+// retrying with exponential backoff and appending undeliverable events to a
+// dead-letter JSONL file.
+type WebhookDispatcher struct {
+    Endpoints      []WebhookEndpoint
+    MaxRetries     int
+    BaseDelay      time.Duration
+    MaxDelay       time.Duration
+    DeadLetterPath string
+    HTTP           *http.Client
+
+    wg sync.WaitGroup
+    mu sync.Mutex // guards the dead-letter file
+}
+
+// LoadWebhookDispatcher reads a WebhookConfig JSON file and applies defaults.
+func LoadWebhookDispatcher(path string) (*WebhookDispatcher, error) {
+    b, err := os.ReadFile(path)
+    if err != nil { return nil, err }
+    var cfg WebhookConfig
+    if err := json.Unmarshal(b, &cfg); err != nil { return nil, fmt.Errorf("%s: %w", path, err) }
+    d := &WebhookDispatcher{Endpoints: cfg.Endpoints, MaxRetries: cfg.MaxRetries, DeadLetterPath: cfg.DeadLetter, BaseDelay: 500 * time.Millisecond, MaxDelay: 30 * time.Second}
+    timeout := 5 * time.Second
+    for _, p := range []struct{ s string; d *time.Duration }{{cfg.BaseDelay, &d.BaseDelay}, {cfg.MaxDelay, &d.MaxDelay}, {cfg.Timeout, &timeout}} {
+        if p.s == "" { continue }
+        v, err := time.ParseDuration(p.s)
+        if err != nil { return nil, fmt.Errorf("%s: %w", path, err) }
+        *p.d = v
+    }
+    if d.MaxRetries <= 0 { d.MaxRetries = 5 }
+    if d.DeadLetterPath == "" { d.DeadLetterPath = "webhooks.dead.jsonl" }
+    d.HTTP = &http.Client{Timeout: timeout}
+    return d, nil
+}
+
+// SignWebhook returns the hex HMAC-SHA256 of "<timestamp>.<body>".
+func SignWebhook(secret []byte, ts string, body []byte) string {
+    mac := hmac.New(sha256.New, secret)
+    mac.Write([]byte(ts + "."))
+    mac.Write(body)
+    return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Dispatch delivers the event to every subscribed endpoint in the background.
+// The payload is the given fields plus "event"; callers pass audit event fields.
+func (d *WebhookDispatcher) Dispatch(event string, fields map[string]any) {
+    payload := make(map[string]any, len(fields)+1)
+    for k, v := range fields { payload[k] = v }
+    payload["event"] = event
+    body, err := json.Marshal(payload)
+    if err != nil { return }
+    for _, ep := range d.Endpoints {
+        if !subscribed(ep, event) { continue }
+        d.wg.Add(1)
+        go func(ep WebhookEndpoint) {
+            defer d.wg.Done()
+            if err := d.Deliver(ep, event, body); err != nil { d.deadLetter(ep, event, body, err) }
+        }(ep)
+    }
+}
+
+// Wait blocks until in-flight deliveries have finished or been dead-lettered.
+func (d *WebhookDispatcher) Wait() { d.wg.Wait() }
+
+// Deliver posts body to one endpoint, retrying non-2xx responses and transport
+// errors with exponential backoff up to MaxRetries attempts.
+func (d *WebhookDispatcher) Deliver(ep WebhookEndpoint, event string, body []byte) error {
+    delay := d.BaseDelay
+    var lastErr error
+    for attempt := 1; attempt <= d.MaxRetries; attempt++ {
+        ts := strconv.FormatInt(time.Now().Unix(), 10)
+        req, err := http.NewRequest(http.MethodPost, ep.URL, bytes.NewReader(body))
+        if err != nil { return err }
+        req.Header.Set("content-type", "application/json")
+        req.Header.Set("X-AIS-Event", event)
+        req.Header.Set("X-AIS-Timestamp", ts)
+        req.Header.Set("X-AIS-Attempt", strconv.Itoa(attempt))
+        if ep.Secret != "" { req.Header.Set("X-AIS-Signature", "sha256="+SignWebhook([]byte(ep.Secret), ts, body)) }
+        resp, err := d.HTTP.Do(req)
+        if err == nil {
+            resp.Body.Close()
+            if resp.StatusCode >= 200 && resp.StatusCode < 300 { return nil }
+            err = fmt.Errorf("webhook status %d", resp.StatusCode)
+        }
+        lastErr = err
+        if attempt == d.MaxRetries { break }
+        time.Sleep(delay)
+        delay *= 2
+        if d.MaxDelay > 0 && delay > d.MaxDelay { delay = d.MaxDelay }
+    }
+    return lastErr
+}
+
+func (d *WebhookDispatcher) deadLetter(ep WebhookEndpoint, event string, body []byte, cause error) {
+    rec, _ := json.Marshal(map[string]any{"ts": time.Now().UTC().Format(time.RFC3339), "url": ep.URL, "event": event, "error": cause.Error(), "payload": json.RawMessage(body)})
+    d.mu.Lock()
+    defer d.mu.Unlock()
+    f, err := os.OpenFile(d.DeadLetterPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+    if err != nil { return }
+    _, _ = f.Write(append(rec, '\n'))
+    _ = f.Close()
+}
+
+func subscribed(ep WebhookEndpoint, event string) bool {
+    for _, e := range ep.Events { if e == "*" || e == event { return true } }
+    return false
+}
@@ -0,0 +1,219 @@
+package ais
+
+import (
+    "bytes"
+    "context"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "mime"
+    "mime/quotedprintable"
+    "net/mail"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
+)
+
+// FileWriteTool is file.write: writes args["content"] to args["path"] inside
+// the scope's roots, atomically (temp file + rename). Existing files are only
+// replaced when args["overwrite"] is true; symlinks are never written through.
+type FileWriteTool struct{ *FileScope }
+
+func (FileWriteTool) Name() string { return "file.write" }
+
+// TCA declares one write per call, confined to the scope's roots and globs.
+func (t FileWriteTool) TCA() TCA {
+    eff := OperationEffects{Writes: 1, DataClasses: []string{"derived"}, Roots: t.Roots, Globs: t.Globs}
+    return TCA{ID: "urn:tca:file.write@1", Operator: "local", Operations: []TCAOperation{{Name: "file.write", Effects: eff}}}
+}
+
+func (FileWriteTool) InputSchema() map[string]any {
+    return map[string]any{"type": "object", "properties": map[string]any{
+        "path":      map[string]any{"type": "string", "minLength": 1},
+        "content":   map[string]any{"type": "string"},
+        "overwrite": map[string]any{"type": "boolean"},
+    }, "required": []string{"path", "content"}}
+}
+
+func (t FileWriteTool) ValidateArgs(args map[string]any) error {
+    if p, ok := args["path"].(string); !ok || p == "" { return errors.New("path must be a non-empty string") }
+    c, ok := args["content"].(string)
+    if !ok { return errors.New("content must be a string") }
+    if o, ok := args["overwrite"]; ok {
+        if _, ok := o.(bool); !ok { return errors.New("overwrite must be a boolean") }
+    }
+    maxBytes := t.MaxBytes
+    if maxBytes <= 0 { maxBytes = DefaultFileMaxBytes }
+    if int64(len(c)) > maxBytes { return fmt.Errorf("content exceeds %d bytes", maxBytes) }
+    return nil
+}
+
+// LabelArgs checks the target is in scope; written content is derived.
+func (t FileWriteTool) LabelArgs(args map[string]any) ([]string, error) {
+    p, _ := args["path"].(string)
+    if _, _, err := t.target(p); err != nil { return nil, err }
+    return []string{"derived"}, nil
+}
+
+// target resolves the parent directory (the file may not exist yet) and
+// returns the path to write and its root-relative name.
+func (t FileWriteTool) target(p string) (string, string, error) {
+    dir, _, rel, err := t.Resolve(filepath.Dir(p))
+    if err != nil { return "", "", err }
+    name := filepath.Base(p)
+    if name == "." || name == ".." || name == string(filepath.Separator) { return "", "", fmt.Errorf("%w: %s", ErrPathNotAllowed, p) }
+    if rel != "." { name = rel + "/" + name }
+    if !t.matches(name) { return "", "", fmt.Errorf("%w: %s", ErrPathNotAllowed, p) }
+    return filepath.Join(dir, filepath.Base(p)), name, nil
+}
+
+func (t FileWriteTool) Invoke(ctx context.Context, args map[string]any) (Result, error) {
+    if err := t.ValidateArgs(args); err != nil { return Result{}, err }
+    dst, rel, err := t.target(args["path"].(string))
+    if err != nil { return Result{}, err }
+    overwrite, _ := args["overwrite"].(bool)
+    if fi, err := os.Lstat(dst); err == nil {
+        if fi.Mode()&os.ModeSymlink != 0 || fi.IsDir() { return Result{}, fmt.Errorf("%w: %s is not a regular file", ErrPathNotAllowed, rel) }
+        if !overwrite { return Result{}, fmt.Errorf("file.write: %s exists", rel) }
+    }
+    content := []byte(args["content"].(string))
+    if err := writeAtomic(dst, content); err != nil { return Result{}, err }
+    sum := sha256.Sum256(content)
+    return Result{Output: fmt.Sprintf("wrote %d bytes to %s", len(content), rel), Writes: 1, Meta: map[string]any{"path": rel, "bytes": len(content), "bodyHash": "sha256:" + hex.EncodeToString(sum[:])}}, nil
+}
+
+// writeAtomic writes b to a temp file next to dst and renames it into place,
+// so readers never see a partial file.
+func writeAtomic(dst string, b []byte) error {
+    f, err := os.CreateTemp(filepath.Dir(dst), ".tmp-*")
+    if err != nil { return err }
+    tmp := f.Name()
+    defer os.Remove(tmp)
+    if _, err := f.Write(b); err != nil { f.Close(); return err }
+    if err := f.Sync(); err != nil { f.Close(); return err }
+    if err := f.Close(); err != nil { return err }
+    if err := os.Chmod(tmp, 0644); err != nil { return err }
+    return os.Rename(tmp, dst)
+}
+
+// EmailTool is email.send: instead of talking SMTP it writes an RFC 5322
+// message to Outbox as <message-id>.eml. Domains are the recipient domains
+// the TCA declares as destinations.
+type EmailTool struct {
+    Outbox   string
+    From     string
+    Domains  []string
+    MaxBytes int64
+}
+
+func (EmailTool) Name() string { return "email.send" }
+
+func (e EmailTool) TCA() TCA {
+    return TCA{ID: "urn:tca:email.send@1", Operator: "local", Operations: []TCAOperation{{Name: "email.send", Effects: OperationEffects{Writes: 1, DataClasses: []string{"derived"}, Destinations: e.Domains}}}}
+}
+
+// recipients returns args["to"] (a string or list) as parsed addresses.
+func recipients(args map[string]any) ([]*mail.Address, error) {
+    var raw []string
+    switch v := args["to"].(type) {
+    case string:
+        raw = []string{v}
+    case []string:
+        raw = v
+    case []any:
+        for _, x := range v {
+            s, ok := x.(string)
+            if !ok { return nil, errors.New("to must be addresses") }
+            raw = append(raw, s)
+        }
+    default:
+        return nil, errors.New("to must be an address or a list of addresses")
+    }
+    if len(raw) == 0 { return nil, errors.New("to is empty") }
+    out := make([]*mail.Address, 0, len(raw))
+    for _, r := range raw {
+        a, err := mail.ParseAddress(r)
+        if err != nil { return nil, fmt.Errorf("to: %w", err) }
+        out = append(out, a)
+    }
+    return out, nil
+}
+
+func (EmailTool) InputSchema() map[string]any {
+    addr := map[string]any{"type": "string"}
+    return map[string]any{"type": "object", "properties": map[string]any{
+        "to":      map[string]any{"anyOf": []any{addr, map[string]any{"type": "array", "items": addr, "minItems": 1}}},
+        "subject": map[string]any{"type": "string", "minLength": 1},
+        "body":    map[string]any{"type": "string"},
+    }, "required": []string{"to", "subject", "body"}}
+}
+
+func (e EmailTool) ValidateArgs(args map[string]any) error {
+    if _, err := recipients(args); err != nil { return err }
+    subject, ok := args["subject"].(string)
+    if !ok || subject == "" { return errors.New("subject must be a non-empty string") }
+    if strings.ContainsAny(subject, "\r\n") { return errors.New("subject must be a single line") }
+    body, ok := args["body"].(string)
+    if !ok { return errors.New("body must be a string") }
+    maxBytes := e.MaxBytes
+    if maxBytes <= 0 { maxBytes = DefaultFileMaxBytes }
+    if int64(len(body)) > maxBytes { return fmt.Errorf("body exceeds %d bytes", maxBytes) }
+    return nil
+}
+
+// ArgDestinations names each recipient as a mailto: URL.
+func (EmailTool) ArgDestinations(args map[string]any) []string {
+    to, err := recipients(args)
+    if err != nil { return []string{"mailto:"} }
+    out := make([]string, 0, len(to))
+    for _, a := range to { out = append(out, "mailto:"+a.Address) }
+    return out
+}
+
+func (e EmailTool) Invoke(ctx context.Context, args map[string]any) (Result, error) {
+    if err := e.ValidateArgs(args); err != nil { return Result{}, err }
+    to, _ := recipients(args)
+    for _, a := range to {
+        if !DestinationAllowed(e.Domains, "mailto:"+a.Address) { return Result{}, fmt.Errorf("%w: %s", ErrDestinationNotAllowed, a.Address) }
+    }
+    from := e.From
+    if from == "" { from = "ais-demo@localhost" }
+    id := make([]byte, 12)
+    _, _ = rand.Read(id)
+    msgID := hex.EncodeToString(id)
+    _, host, _ := strings.Cut(from, "@")
+    msg := composeMessage(from, to, args["subject"].(string), args["body"].(string), msgID+"@"+host, time.Now())
+    if err := os.MkdirAll(e.Outbox, 0755); err != nil { return Result{}, err }
+    path := filepath.Join(e.Outbox, msgID+".eml")
+    if err := writeAtomic(path, msg); err != nil { return Result{}, err }
+    addrs := make([]string, 0, len(to))
+    for _, a := range to { addrs = append(addrs, a.Address) }
+    sum := sha256.Sum256(msg)
+    return Result{Output: fmt.Sprintf("queued message <%s@%s> for %s", msgID, host, strings.Join(addrs, ", ")), Writes: 1, Meta: map[string]any{"messageId": msgID + "@" + host, "to": addrs, "outbox": path, "bytes": len(msg), "bodyHash": "sha256:" + hex.EncodeToString(sum[:])}}, nil
+}
+
+// composeMessage renders a text/plain RFC 5322 message with CRLF line endings.
+func composeMessage(from string, to []*mail.Address, subject, body, msgID string, now time.Time) []byte {
+    var b bytes.Buffer
+    rcpt := make([]string, 0, len(to))
+    for _, a := range to { rcpt = append(rcpt, a.String()) }
+    hdr := [][2]string{
+        {"From", from},
+        {"To", strings.Join(rcpt, ", ")},
+        {"Subject", mime.QEncoding.Encode("utf-8", subject)},
+        {"Date", now.Format(time.RFC1123Z)},
+        {"Message-ID", "<" + msgID + ">"},
+        {"MIME-Version", "1.0"},
+        {"Content-Type", "text/plain; charset=utf-8"},
+        {"Content-Transfer-Encoding", "quoted-printable"},
+    }
+    for _, h := range hdr { fmt.Fprintf(&b, "%s: %s\r\n", h[0], h[1]) }
+    b.WriteString("\r\n")
+    qp := quotedprintable.NewWriter(&b)
+    _, _ = qp.Write([]byte(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n")))
+    _ = qp.Close()
+    return b.Bytes()
+}
@@ -0,0 +1,203 @@
+package mcp
+
+import (
+    "bufio"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "os/exec"
+    "slices"
+    "strconv"
+    "sync"
+    "time"
+)
+
+// ErrClientClosed is returned for calls on a client whose server has gone.
+var ErrClientClosed = errors.New("mcp: connection closed")
+
+// Client talks to an MCP server over newline-delimited stdio. Calls may run
+// concurrently; replies are matched by id. Requests from the server (e.g.
+// sampling) are refused with method-not-found.
+type Client struct {
+    Name    string
+    Version string
+    // ServerInfo and ProtocolVersion are set by Initialize.
+    ServerInfo      map[string]any
+    ProtocolVersion string
+
+    cmd     *exec.Cmd
+    w       io.WriteCloser
+    wmu     sync.Mutex
+    mu      sync.Mutex
+    next    int
+    pending map[string]chan reply
+    err     error
+}
+
+type reply struct {
+    Result json.RawMessage
+    Error  *Error
+}
+
+// NewClient speaks MCP on r and w; the caller runs Initialize.
+func NewClient(r io.Reader, w io.WriteCloser) *Client {
+    c := &Client{Name: "ais-demo", Version: "0.1.0", w: w, pending: map[string]chan reply{}}
+    go c.readLoop(r)
+    return c
+}
+
+// StartClient starts cmd as a stdio MCP server and initializes the session.
+// The caller sets cmd.Stderr and cmd.Env; Close stops the process.
+func StartClient(ctx context.Context, cmd *exec.Cmd) (*Client, error) {
+    in, err := cmd.StdinPipe()
+    if err != nil { return nil, err }
+    out, err := cmd.StdoutPipe()
+    if err != nil { return nil, err }
+    if err := cmd.Start(); err != nil { return nil, fmt.Errorf("mcp: start %s: %w", cmd.Path, err) }
+    c := NewClient(out, in)
+    c.cmd = cmd
+    if err := c.Initialize(ctx); err != nil { _ = c.Close(); return nil, err }
+    return c, nil
+}
+
+// Initialize negotiates the protocol version and completes the handshake.
+func (c *Client) Initialize(ctx context.Context) error {
+    var res struct {
+        ProtocolVersion string         `json:"protocolVersion"`
+        ServerInfo      map[string]any `json:"serverInfo"`
+    }
+    params := map[string]any{"protocolVersion": LatestProtocolVersion, "capabilities": map[string]any{}, "clientInfo": map[string]any{"name": c.Name, "version": c.Version}}
+    if err := c.call(ctx, "initialize", params, &res); err != nil { return fmt.Errorf("mcp: initialize: %w", err) }
+    if !slices.Contains(ProtocolVersions, res.ProtocolVersion) { return fmt.Errorf("mcp: server speaks unsupported protocol version %q", res.ProtocolVersion) }
+    c.ProtocolVersion, c.ServerInfo = res.ProtocolVersion, res.ServerInfo
+    return c.send(Request{JSONRPC: "2.0", Method: "notifications/initialized"})
+}
+
+// ListTools returns every tool the server lists, following pagination.
+func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
+    var all []Tool
+    cursor := ""
+    for {
+        params := map[string]any{}
+        if cursor != "" { params["cursor"] = cursor }
+        var res struct {
+            Tools      []Tool `json:"tools"`
+            NextCursor string `json:"nextCursor"`
+        }
+        if err := c.call(ctx, "tools/list", params, &res); err != nil { return nil, fmt.Errorf("mcp: tools/list: %w", err) }
+        all = append(all, res.Tools...)
+        if res.NextCursor == "" || res.NextCursor == cursor { return all, nil }
+        cursor = res.NextCursor
+    }
+}
+
+// CallTool calls a tool; a tool failure is a result with IsError set, not an error.
+func (c *Client) CallTool(ctx context.Context, name string, args map[string]any) (CallToolResult, error) {
+    var res CallToolResult
+    if args == nil { args = map[string]any{} }
+    err := c.call(ctx, "tools/call", map[string]any{"name": name, "arguments": args}, &res)
+    return res, err
+}
+
+// Close closes the server's stdin and, for a started server, waits briefly
+// for it to exit before killing it.
+func (c *Client) Close() error {
+    err := c.w.Close()
+    if c.cmd == nil { return err }
+    done := make(chan error, 1)
+    go func() { done <- c.cmd.Wait() }()
+    select {
+    case <-done:
+    case <-time.After(2 * time.Second):
+        _ = c.cmd.Process.Kill()
+        <-done
+    }
+    return err
+}
+
+func (c *Client) call(ctx context.Context, method string, params any, out any) error {
+    raw, err := json.Marshal(params)
+    if err != nil { return err }
+    c.mu.Lock()
+    if c.err != nil { c.mu.Unlock(); return c.err }
+    c.next++
+    id := strconv.Itoa(c.next)
+    ch := make(chan reply, 1)
+    c.pending[id] = ch
+    c.mu.Unlock()
+    if err := c.send(Request{JSONRPC: "2.0", ID: json.RawMessage(id), Method: method, Params: raw}); err != nil {
+        c.forget(id)
+        return err
+    }
+    select {
+    case rep, ok := <-ch:
+        if !ok { return c.closedErr() }
+        if rep.Error != nil { return rep.Error }
+        return json.Unmarshal(rep.Result, out)
+    case <-ctx.Done():
+        c.forget(id)
+        cancel, _ := json.Marshal(map[string]any{"requestId": json.RawMessage(id), "reason": ctx.Err().Error()})
+        _ = c.send(Request{JSONRPC: "2.0", Method: "notifications/cancelled", Params: cancel})
+        return ctx.Err()
+    }
+}
+
+func (c *Client) send(req Request) error {
+    b, err := json.Marshal(req)
+    if err != nil { return err }
+    c.wmu.Lock()
+    defer c.wmu.Unlock()
+    if _, err := c.w.Write(append(b, '\n')); err != nil { return fmt.Errorf("mcp: write: %w", err) }
+    return nil
+}
+
+func (c *Client) forget(id string) {
+    c.mu.Lock()
+    delete(c.pending, id)
+    c.mu.Unlock()
+}
+
+func (c *Client) closedErr() error {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return c.err
+}
+
+// readLoop routes replies to their callers until the server's stdout closes,
+// then fails every pending call.
+func (c *Client) readLoop(r io.Reader) {
+    sc := bufio.NewScanner(r)
+    sc.Buffer(make([]byte, 64<<10), maxMessageBytes)
+    for sc.Scan() {
+        var msg struct {
+            ID     json.RawMessage `json:"id"`
+            Method string          `json:"method"`
+            Result json.RawMessage `json:"result"`
+            Error  *Error          `json:"error"`
+        }
+        if json.Unmarshal(sc.Bytes(), &msg) != nil { continue }
+        if msg.Method != "" {
+            if len(msg.ID) > 0 { _ = c.sendResponse(errorResponse(msg.ID, CodeMethodNotFound, "client does not handle "+msg.Method)) }
+            continue
+        }
+        c.mu.Lock()
+        ch := c.pending[string(msg.ID)]
+        delete(c.pending, string(msg.ID))
+        c.mu.Unlock()
+        if ch != nil { ch <- reply{Result: msg.Result, Error: msg.Error} }
+    }
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.err = ErrClientClosed
+    if err := sc.Err(); err != nil { c.err = fmt.Errorf("%w: %v", ErrClientClosed, err) }
+    for id, ch := range c.pending { close(ch); delete(c.pending, id) }
+}
+
+func (c *Client) sendResponse(r Response) error {
+    c.wmu.Lock()
+    defer c.wmu.Unlock()
+    _, err := c.w.Write(append(encode(r), '\n'))
+    return err
+}
@@ -0,0 +1,153 @@
+package mcp
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "time"
+
+    "ais-demo/internal/ais"
+)
+
+// Meta keys a tools/call must carry: the signed IBE for the call and the UIA,
+// APA and APr it references.
+const (
+    MetaIBE = "ais/ibe"
+    MetaUIA = "ais/uia"
+    MetaAPA = "ais/apa"
+    MetaAPr = "ais/apr"
+    // MetaCode carries the AIS error code on a denied call's result.
+    MetaCode = "ais/code"
+)
+
+// GuardedTools exposes a tool registry over MCP. Every call runs the guard
+// with the AIS artifacts from its _meta and must match the APA step the IBE
+// names; denials are tool errors carrying the AIS code.
+type GuardedTools struct {
+    Tools  *ais.ToolRegistry
+    Config func() ais.GuardConfig
+    // Audit receives a guard.deny or tool-call event per call; nil drops them.
+    Audit func(ev map[string]any)
+    // Challenge, if set, handles AUTHZ-NEED-CONSENT (e.g. by queueing the step
+    // for approval) and returns details for the error.
+    Challenge func(uia ais.UIA, apa ais.APA, apr ais.APr, step ais.APAStep) map[string]any
+}
+
+// ListTools lists every registered tool with its arg schema; _meta names the
+// tcaRef an IBE for it must carry and the operation's declared effects.
+func (g *GuardedTools) ListTools(ctx context.Context) ([]Tool, error) {
+    var out []Tool
+    for _, name := range g.Tools.Tools() {
+        t, _ := g.Tools.Lookup(name)
+        tca := t.TCA()
+        meta := map[string]any{"ais/tcaRef": tca.ID}
+        for _, op := range tca.Operations { if op.Name == name { meta["ais/effects"] = op.Effects } }
+        out = append(out, Tool{Name: name, Description: "AIS-guarded " + name + " (" + tca.ID + "); tools/call needs an IBE, UIA, APA and APr in _meta", InputSchema: ais.InputSchema(t), Meta: meta})
+    }
+    return out, nil
+}
+
+// CallTool verifies the call's IBE and artifacts with the guard, then invokes
+// the tool with the APr obligations and remaining record budget, charges the
+// UIA's ledger, scans the output for prompt injection, applies redaction
+// obligations and classifies it.
+func (g *GuardedTools) CallTool(ctx context.Context, p CallToolParams) (CallToolResult, error) {
+    tool, ok := g.Tools.Lookup(p.Name)
+    if !ok { return CallToolResult{}, &Error{Code: CodeInvalidParams, Message: "unknown tool: " + p.Name} }
+    var ibe ais.IBE
+    var uia ais.UIA
+    var apa ais.APA
+    var apr ais.APr
+    for key, dst := range map[string]any{MetaIBE: &ibe, MetaUIA: &uia, MetaAPA: &apa, MetaAPr: &apr} {
+        raw, ok := p.Meta[key]
+        if !ok { return denied("IBE-MISSING", "tools/call _meta needs "+MetaIBE+", "+MetaUIA+", "+MetaAPA+" and "+MetaAPr, nil), nil }
+        if err := json.Unmarshal(raw, dst); err != nil { return denied("INPUT-SCHEMA-INVALID", key+": "+err.Error(), nil), nil }
+    }
+    cfg := g.Config()
+    var step *ais.APAStep
+    for i := range apa.Steps { if apa.Steps[i].ID == ibe.APAStepRef { step = &apa.Steps[i] } }
+    err := ais.CheckRefs(ibe, uia, apa, apr)
+    // the call must be the step the IBE authorizes, not merely a step of the plan;
+    // args filling in ${steps...} references are matched by the guard
+    var args map[string]any
+    if step != nil && ais.HasStepRefs(step.Args) {
+        if args = p.Arguments; args == nil { args = map[string]any{} }
+    }
+    if err == nil && step != nil && (step.Tool != p.Name || args == nil && !sameArgs(step.Args, p.Arguments)) { err = errors.New("IBE-STEP-MISMATCH") }
+    if err == nil { err = ais.VerifyIBEArgsContext(ctx, cfg, ibe, apr, uia, apa, tool.TCA(), args) }
+    if err != nil { return g.deny(err, ibe, uia, apa, apr, step), nil }
+
+    ctx = ais.WithObligations(ctx, apr.Evidence.Obligations)
+    hold, err := cfg.Ledger.Reserve(uia, step.Expected.Writes)
+    if err != nil { return g.deny(err, ibe, uia, apa, apr, step), nil }
+    ctx = ais.WithRecordLimit(ctx, hold.Records())
+    // run the tool with the args the guard checked
+    call := step.Args
+    if args != nil { call = args }
+    res, err := tool.Invoke(ctx, call)
+    hold.Settle(res)
+    if err != nil {
+        g.audit(map[string]any{"ts": time.Now().UTC().Format(time.RFC3339), "transport": "mcp", "uia": uia.ID, "apa": apa.ID, "ibe": ibe.ID, "tool": p.Name, "ok": false, "error": err.Error(), "writes": res.Writes, "spent": cfg.Ledger.Usage(uia.ID)})
+        return CallToolResult{Content: []Content{{Type: "text", Text: err.Error()}}, IsError: true}, nil
+    }
+    out, rep, err := ais.CheckResult(cfg, p.Name, uia, apr, res.Output)
+    var inj *ais.InjectionError
+    var de *ais.DLPError
+    if errors.As(err, &inj) || errors.As(err, &de) { return g.deny(err, ibe, uia, apa, apr, step), nil }
+    if err != nil {
+        g.audit(map[string]any{"ts": time.Now().UTC().Format(time.RFC3339), "transport": "mcp", "uia": uia.ID, "apa": apa.ID, "ibe": ibe.ID, "tool": p.Name, "ok": false, "error": err.Error()})
+        return CallToolResult{Content: []Content{{Type: "text", Text: err.Error()}}, IsError: true}, nil
+    }
+    out = ais.ApplyObligations(apr.Evidence.Obligations, out)
+    sum := sha256.Sum256([]byte(out))
+    ev := map[string]any{"ts": time.Now().UTC().Format(time.RFC3339), "transport": "mcp", "uia": uia.ID, "apa": apa.ID, "ibe": ibe.ID, "tool": p.Name, "ok": true, "resultHash": hex.EncodeToString(sum[:]), "result": res.Meta, "writes": res.Writes, "records": res.Records, "spent": cfg.Ledger.Usage(uia.ID)}
+    rep.AddTo(ev)
+    g.audit(ev)
+    return TextResult(out), nil
+}
+
+// deny audits a guard denial and returns it as a tool error.
+func (g *GuardedTools) deny(err error, ibe ais.IBE, uia ais.UIA, apa ais.APA, apr ais.APr, step *ais.APAStep) CallToolResult {
+    code := err.Error()
+    details := map[string]any{"ibe": ibe.ID}
+    if code == "AUTHZ-NEED-CONSENT" && g.Challenge != nil && step != nil {
+        for k, v := range g.Challenge(uia, apa, apr, *step) { details[k] = v }
+        return denied(code, "step requires approval", details)
+    }
+    ev := map[string]any{"ts": time.Now().UTC().Format(time.RFC3339), "event": "guard.deny", "transport": "mcp", "code": code, "uia": uia.ID, "apa": apa.ID, "apr": apr.ID, "ibe": ibe.ID, "tca": ibe.TCARef, "step": ibe.APAStepRef, "ok": false}
+    if step != nil { ev["tool"] = step.Tool }
+    var pd *ais.PolicyDenyError
+    if errors.As(err, &pd) { ev["reasons"], details["reasons"] = pd.Reasons, pd.Reasons }
+    var inj *ais.InjectionError
+    if errors.As(err, &inj) { ev["findings"], details["findings"] = inj.Findings, inj.Findings }
+    var de *ais.DLPError
+    if errors.As(err, &de) { ev["dlp"], details["dlp"] = de.Report, de.Report }
+    var pe *ais.PlanError
+    if errors.As(err, &pe) { ev["reason"], details["reason"] = pe.Reason, pe.Reason }
+    g.audit(ev)
+    return denied(code, "blocked by guard", details)
+}
+
+func (g *GuardedTools) audit(ev map[string]any) {
+    if g.Audit != nil { g.Audit(ev) }
+}
+
+// denied is a tool error whose text starts with the AIS code; the code,
+// message and details are also in structuredContent (the HTTP error body's
+// shape) and the code in _meta.
+func denied(code, msg string, details map[string]any) CallToolResult {
+    sc := map[string]any{"code": code, "message": msg}
+    if details != nil { sc["details"] = details }
+    return CallToolResult{Content: []Content{{Type: "text", Text: code + ": " + msg}}, StructuredContent: sc, IsError: true, Meta: map[string]any{MetaCode: code}}
+}
+
+// sameArgs compares args by their JSON encoding, so a call decoded from the
+// wire matches the step it was planned as.
+func sameArgs(a, b map[string]any) bool {
+    if len(a) == 0 && len(b) == 0 { return true }
+    ja, err1 := json.Marshal(a)
+    jb, err2 := json.Marshal(b)
+    return err1 == nil && err2 == nil && string(ja) == string(jb)
+}
@@ -0,0 +1,269 @@
+// Package mcp serves tools over the Model Context Protocol: JSON-RPC 2.0
+// over stdio (newline-delimited) and the streamable HTTP transport (one POST
+// endpoint answering with application/json).
+package mcp
+
+import (
+    "bufio"
+    "bytes"
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "encoding/json"
+    "io"
+    "net/http"
+    "net/url"
+    "slices"
+    "strings"
+    "sync"
+)
+
+// LatestProtocolVersion is offered to clients asking for a version this
+// server does not speak.
+const LatestProtocolVersion = "2025-06-18"
+
+// ProtocolVersions are the MCP revisions the server accepts.
+var ProtocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// JSON-RPC error codes.
+const (
+    CodeParseError     = -32700
+    CodeInvalidRequest = -32600
+    CodeMethodNotFound = -32601
+    CodeInvalidParams  = -32602
+    CodeInternalError  = -32603
+)
+
+// maxMessageBytes bounds one JSON-RPC message on either transport.
+const maxMessageBytes = 4 << 20
+
+type Request struct {
+    JSONRPC string          `json:"jsonrpc"`
+    ID      json.RawMessage `json:"id,omitempty"`
+    Method  string          `json:"method"`
+    Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// IsNotification reports whether the message expects no response.
+func (r Request) IsNotification() bool { return len(r.ID) == 0 }
+
+type Response struct {
+    JSONRPC string          `json:"jsonrpc"`
+    ID      json.RawMessage `json:"id"`
+    Result  any             `json:"result,omitempty"`
+    Error   *Error          `json:"error,omitempty"`
+}
+
+// Error is a JSON-RPC error. Handlers return it to fail a request at the
+// protocol level; tool failures are CallToolResults with IsError set.
+type Error struct {
+    Code    int    `json:"code"`
+    Message string `json:"message"`
+    Data    any    `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string { return e.Message }
+
+// Tool is an entry of tools/list.
+type Tool struct {
+    Name        string         `json:"name"`
+    Description string         `json:"description,omitempty"`
+    InputSchema map[string]any `json:"inputSchema"`
+    Meta        map[string]any `json:"_meta,omitempty"`
+}
+
+type Content struct {
+    Type string `json:"type"`
+    Text string `json:"text"`
+}
+
+type CallToolParams struct {
+    Name      string                     `json:"name"`
+    Arguments map[string]any             `json:"arguments,omitempty"`
+    Meta      map[string]json.RawMessage `json:"_meta,omitempty"`
+}
+
+type CallToolResult struct {
+    Content           []Content      `json:"content"`
+    StructuredContent map[string]any `json:"structuredContent,omitempty"`
+    IsError           bool           `json:"isError,omitempty"`
+    Meta              map[string]any `json:"_meta,omitempty"`
+}
+
+// TextResult is a successful single-text result.
+func TextResult(text string) CallToolResult {
+    return CallToolResult{Content: []Content{{Type: "text", Text: text}}}
+}
+
+// Handler supplies the tools a Server exposes.
+type Handler interface {
+    ListTools(ctx context.Context) ([]Tool, error)
+    CallTool(ctx context.Context, p CallToolParams) (CallToolResult, error)
+}
+
+// Server answers MCP requests for a Handler. Over HTTP it issues an
+// Mcp-Session-Id on initialize and requires it afterwards; browser requests
+// are only accepted from localhost or AllowedOrigins.
+type Server struct {
+    Name           string
+    Version        string
+    Handler        Handler
+    AllowedOrigins []string
+
+    mu       sync.Mutex
+    sessions map[string]bool
+}
+
+// Handle answers one JSON-RPC message; it returns nil for notifications and
+// responses.
+func (s *Server) Handle(ctx context.Context, msg []byte) []byte {
+    var req Request
+    if err := json.Unmarshal(msg, &req); err != nil {
+        if t := bytes.TrimSpace(msg); len(t) > 0 && t[0] == '[' { return encode(errorResponse(nil, CodeInvalidRequest, "batches are not supported")) }
+        return encode(errorResponse(nil, CodeParseError, "parse error"))
+    }
+    if req.Method == "" {
+        // a response to a server request; this server sends none
+        if req.IsNotification() { return encode(errorResponse(nil, CodeInvalidRequest, "method is required")) }
+        return nil
+    }
+    if req.JSONRPC != "2.0" {
+        if req.IsNotification() { return nil }
+        return encode(errorResponse(req.ID, CodeInvalidRequest, `jsonrpc must be "2.0"`))
+    }
+    result, err := s.dispatch(ctx, req)
+    if req.IsNotification() { return nil }
+    if err != nil {
+        e, ok := err.(*Error)
+        if !ok { e = &Error{Code: CodeInternalError, Message: err.Error()} }
+        return encode(Response{JSONRPC: "2.0", ID: req.ID, Error: e})
+    }
+    return encode(Response{JSONRPC: "2.0", ID: req.ID, Result: result})
+}
+
+func (s *Server) dispatch(ctx context.Context, req Request) (any, error) {
+    switch req.Method {
+    case "initialize":
+        var p struct{ ProtocolVersion string `json:"protocolVersion"` }
+        if err := json.Unmarshal(req.Params, &p); err != nil { return nil, &Error{Code: CodeInvalidParams, Message: "invalid initialize params"} }
+        v := p.ProtocolVersion
+        if !slices.Contains(ProtocolVersions, v) { v = LatestProtocolVersion }
+        return map[string]any{
+            "protocolVersion": v,
+            "capabilities":    map[string]any{"tools": map[string]any{"listChanged": false}},
+            "serverInfo":      map[string]any{"name": s.Name, "version": s.Version},
+        }, nil
+    case "notifications/initialized", "notifications/cancelled":
+        return nil, nil
+    case "ping":
+        return map[string]any{}, nil
+    case "tools/list":
+        tools, err := s.Handler.ListTools(ctx)
+        if err != nil { return nil, err }
+        return map[string]any{"tools": tools}, nil
+    case "tools/call":
+        var p CallToolParams
+        if err := json.Unmarshal(req.Params, &p); err != nil || p.Name == "" { return nil, &Error{Code: CodeInvalidParams, Message: "tools/call needs a name and object arguments"} }
+        return s.Handler.CallTool(ctx, p)
+    }
+    return nil, &Error{Code: CodeMethodNotFound, Message: "method not found: " + req.Method}
+}
+
+func errorResponse(id json.RawMessage, code int, msg string) Response {
+    if id == nil { id = json.RawMessage("null") }
+    return Response{JSONRPC: "2.0", ID: id, Error: &Error{Code: code, Message: msg}}
+}
+
+func encode(r Response) []byte {
+    b, _ := json.Marshal(r)
+    return b
+}
+
+// ServeStdio reads newline-delimited messages from r and writes responses to
+// w until r is exhausted or ctx is done.
+func (s *Server) ServeStdio(ctx context.Context, r io.Reader, w io.Writer) error {
+    sc := bufio.NewScanner(r)
+    sc.Buffer(make([]byte, 64<<10), maxMessageBytes)
+    for sc.Scan() {
+        if ctx.Err() != nil { return ctx.Err() }
+        line := bytes.TrimSpace(sc.Bytes())
+        if len(line) == 0 { continue }
+        if out := s.Handle(ctx, line); out != nil {
+            if _, err := w.Write(append(out, '\n')); err != nil { return err }
+        }
+    }
+    return sc.Err()
+}
+
+// ServeHTTP implements the streamable HTTP transport on a single endpoint.
+// Responses are plain JSON; the server opens no SSE streams, so GET is 405.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    if !s.originAllowed(r.Header.Get("Origin")) { http.Error(w, "origin not allowed", http.StatusForbidden); return }
+    if v := r.Header.Get("MCP-Protocol-Version"); v != "" && !slices.Contains(ProtocolVersions, v) {
+        http.Error(w, "unsupported MCP-Protocol-Version", http.StatusBadRequest)
+        return
+    }
+    switch r.Method {
+    case http.MethodPost:
+    case http.MethodDelete:
+        if !s.endSession(r.Header.Get("Mcp-Session-Id")) { http.Error(w, "unknown session", http.StatusNotFound); return }
+        w.WriteHeader(http.StatusNoContent)
+        return
+    default:
+        w.Header().Set("Allow", "POST, DELETE")
+        http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+    body, err := io.ReadAll(io.LimitReader(r.Body, maxMessageBytes+1))
+    if err != nil || len(body) > maxMessageBytes { http.Error(w, "message too large", http.StatusRequestEntityTooLarge); return }
+    var req Request
+    _ = json.Unmarshal(body, &req)
+    if req.Method == "initialize" {
+        w.Header().Set("Mcp-Session-Id", s.newSession())
+    } else if sid := r.Header.Get("Mcp-Session-Id"); sid == "" {
+        http.Error(w, "Mcp-Session-Id required", http.StatusBadRequest)
+        return
+    } else if !s.hasSession(sid) {
+        http.Error(w, "unknown session", http.StatusNotFound)
+        return
+    }
+    out := s.Handle(r.Context(), body)
+    if out == nil { w.WriteHeader(http.StatusAccepted); return }
+    w.Header().Set("Content-Type", "application/json")
+    _, _ = w.Write(out)
+}
+
+// originAllowed guards against DNS rebinding: requests without an Origin
+// (non-browser clients) pass, browsers only from localhost or AllowedOrigins.
+func (s *Server) originAllowed(origin string) bool {
+    if origin == "" || slices.Contains(s.AllowedOrigins, origin) { return true }
+    u, err := url.Parse(origin)
+    if err != nil { return false }
+    h := strings.ToLower(u.Hostname())
+    return h == "localhost" || h == "127.0.0.1" || h == "::1"
+}
+
+func (s *Server) newSession() string {
+    b := make([]byte, 16)
+    _, _ = rand.Read(b)
+    id := hex.EncodeToString(b)
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if s.sessions == nil { s.sessions = map[string]bool{} }
+    s.sessions[id] = true
+    return id
+}
+
+func (s *Server) hasSession(id string) bool {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.sessions[id]
+}
+
+func (s *Server) endSession(id string) bool {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if !s.sessions[id] { return false }
+    delete(s.sessions, id)
+    return true
+}
@@ -0,0 +1,132 @@
+package mcp
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "os"
+    "slices"
+    "sort"
+    "strings"
+
+    "ais-demo/internal/ais"
+)
+
+// ProxyConfig describes a downstream MCP server the operator does not
+// control. Its tools/list schemas say what the tools take, not what they do,
+// so effects come from the operator: Tools per tool, Defaults for the rest.
+// Without Defaults an unlisted tool is assumed to write once and return
+// derived data, so read-only UIAs cannot call it.
+type ProxyConfig struct {
+    // Server names the TCA, urn:tca:mcp:<server>@1.
+    Server   string                          `json:"server"`
+    Operator string                          `json:"operator,omitempty"`
+    // Command starts the server (stdio transport).
+    Command  []string                        `json:"command"`
+    // Env adds KEY=value entries to the server's environment.
+    Env      []string                        `json:"env,omitempty"`
+    // Prefix is prepended to tool names upstream, e.g. "files.".
+    Prefix   string                          `json:"prefix,omitempty"`
+    Defaults *ais.OperationEffects           `json:"defaults,omitempty"`
+    Tools    map[string]ais.OperationEffects `json:"tools,omitempty"`
+    // Hide lists downstream tools that are not exposed.
+    Hide     []string                        `json:"hide,omitempty"`
+}
+
+// LoadProxyConfig reads a ProxyConfig from a JSON file.
+func LoadProxyConfig(path string) (ProxyConfig, error) {
+    var pc ProxyConfig
+    b, err := os.ReadFile(path)
+    if err != nil { return pc, err }
+    if err := json.Unmarshal(b, &pc); err != nil { return pc, fmt.Errorf("%s: %w", path, err) }
+    if pc.Server == "" { return pc, fmt.Errorf("%s: server is required", path) }
+    return pc, nil
+}
+
+// RemoteError is a downstream tool's own error result.
+type RemoteError struct {
+    Tool string
+    Text string
+}
+
+func (e *RemoteError) Error() string { return "mcp: " + e.Tool + ": " + e.Text }
+
+// Proxy exposes a downstream server's tools as AIS tools sharing one TCA,
+// with an operation per tool carrying its effects and its input schema as
+// ArgsSchema, so the guard checks args against the attested schema.
+type Proxy struct {
+    Client *Client
+    Config ProxyConfig
+    tca    ais.TCA
+    tools  []ais.Tool
+}
+
+// NewProxy lists the downstream tools and builds their TCA. Effects naming a
+// tool the server does not list are an error, so a typo cannot leave a tool
+// on the defaults.
+func NewProxy(ctx context.Context, c *Client, pc ProxyConfig) (*Proxy, error) {
+    listed, err := c.ListTools(ctx)
+    if err != nil { return nil, err }
+    operator := pc.Operator
+    if operator == "" { operator = "mcp:" + pc.Server }
+    p := &Proxy{Client: c, Config: pc, tca: ais.TCA{ID: "urn:tca:mcp:" + pc.Server + "@1", Operator: operator}}
+    sort.Slice(listed, func(i, j int) bool { return listed[i].Name < listed[j].Name })
+    seen := map[string]bool{}
+    for _, t := range listed {
+        seen[t.Name] = true
+        if slices.Contains(pc.Hide, t.Name) { continue }
+        eff, ok := pc.Tools[t.Name]
+        if !ok && pc.Defaults != nil { eff = *pc.Defaults }
+        if !ok && pc.Defaults == nil { eff = ais.OperationEffects{Writes: 1, DataClasses: []string{"derived"}} }
+        schema := t.InputSchema
+        if schema == nil { schema = map[string]any{"type": "object"} }
+        rt := &RemoteTool{proxy: p, Remote: t.Name, Description: t.Description, Effects: eff, Schema: schema}
+        p.tca.Operations = append(p.tca.Operations, ais.TCAOperation{Name: rt.Name(), Effects: eff, ArgsSchema: schema})
+        p.tools = append(p.tools, rt)
+    }
+    for name := range pc.Tools {
+        if !seen[name] { return nil, fmt.Errorf("mcp: %s has no tool %q", pc.Server, name) }
+    }
+    return p, nil
+}
+
+func (p *Proxy) TCA() ais.TCA { return p.tca }
+
+// Tools returns the exposed tools, for registering with a ToolRegistry.
+func (p *Proxy) Tools() []ais.Tool { return p.tools }
+
+// RemoteTool forwards invocations to one downstream tool.
+type RemoteTool struct {
+    proxy       *Proxy
+    Remote      string
+    Description string
+    Effects     ais.OperationEffects
+    Schema      map[string]any
+}
+
+func (t *RemoteTool) Name() string { return t.proxy.Config.Prefix + t.Remote }
+
+func (t *RemoteTool) TCA() ais.TCA { return t.proxy.tca }
+
+func (t *RemoteTool) InputSchema() map[string]any { return t.Schema }
+
+func (t *RemoteTool) ValidateArgs(args map[string]any) error { return ais.ValidateSchema(t.Schema, args) }
+
+// Invoke calls the downstream tool and returns its text content. Writes are
+// charged as declared, since the proxy cannot see what the tool did; that
+// holds for the tool's own error results too, which come back with a
+// RemoteError. Only a call that never got a result charges nothing.
+func (t *RemoteTool) Invoke(ctx context.Context, args map[string]any) (ais.Result, error) {
+    if err := t.ValidateArgs(args); err != nil { return ais.Result{}, err }
+    res, err := t.proxy.Client.CallTool(ctx, t.Remote, args)
+    if err != nil { return ais.Result{}, fmt.Errorf("mcp: %s: %w", t.Remote, err) }
+    var texts []string
+    for _, c := range res.Content { if c.Type == "text" { texts = append(texts, c.Text) } }
+    out := strings.Join(texts, "\n")
+    sum := sha256.Sum256([]byte(out))
+    r := ais.Result{Output: out, Writes: t.Effects.Writes, Meta: map[string]any{"server": t.proxy.Config.Server, "tool": t.Remote, "bytes": len(out), "bodyHash": "sha256:" + hex.EncodeToString(sum[:])}}
+    if res.IsError { return r, &RemoteError{Tool: t.Remote, Text: out} }
+    return r, nil
+}
@@ -0,0 +1,53 @@
+// Package sqlitecheck is a separate module so the SQLite driver, which needs
+// a newer Go than ais-demo, stays out of the main module: run
+// `cd internal/sqlitecheck && go test .`.
+package sqlitecheck
+
+import (
+    "context"
+    "database/sql"
+    "path/filepath"
+    "strings"
+    "testing"
+
+    "ais-demo/internal/ais"
+    _ "modernc.org/sqlite"
+)
+
+// TestSQLiteReadOnlyDSNRefusesWrites opens a real database through
+// SQLiteReadOnlyDSN: sql.query reads it, and the driver refuses writes that
+// the statement allowlist never gets to see.
+func TestSQLiteReadOnlyDSNRefusesWrites(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "chat notes.db")
+    rw, err := sql.Open("sqlite", path)
+    if err != nil { t.Fatal(err) }
+    for _, stmt := range []string{"CREATE TABLE notes (id INTEGER PRIMARY KEY, body TEXT)", "INSERT INTO notes (body) VALUES ('release on friday')"} {
+        if _, err := rw.Exec(stmt); err != nil { t.Fatalf("%s: %v", stmt, err) }
+    }
+    if err := rw.Close(); err != nil { t.Fatal(err) }
+
+    db, err := sql.Open("sqlite", ais.SQLiteReadOnlyDSN(path))
+    if err != nil { t.Fatal(err) }
+    defer db.Close()
+    db.SetMaxOpenConns(1)
+    res, err := ais.SQLTool{DB: db}.Invoke(context.Background(), map[string]any{"query": "SELECT body FROM notes"})
+    if err != nil { t.Fatalf("select: %v", err) }
+    if res.Records != 1 || !strings.Contains(res.Output, "release on friday") { t.Fatalf("select: got %+v", res) }
+
+    for _, stmt := range []string{
+        "INSERT INTO notes (body) VALUES ('injected')",
+        "UPDATE notes SET body = 'changed'",
+        "DELETE FROM notes",
+        "CREATE TABLE more (x)",
+        "PRAGMA query_only = 0; INSERT INTO notes (body) VALUES ('injected')",
+    } {
+        if _, err := db.Exec(stmt); err == nil { t.Errorf("%s: write was not refused", stmt) }
+    }
+    var n int
+    if err := db.QueryRow("SELECT count(*) FROM notes WHERE body = 'release on friday'").Scan(&n); err != nil || n != 1 {
+        t.Fatalf("notes changed: count %d, %v", n, err)
+    }
+    if err := db.QueryRow("SELECT count(*) FROM notes").Scan(&n); err != nil || n != 1 {
+        t.Fatalf("notes changed: count %d, %v", n, err)
+    }
+}